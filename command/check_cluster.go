@@ -0,0 +1,111 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine/log"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+)
+
+var (
+	// CheckClusterCliCommand represent the CLI command "check-cluster" with its flags
+	CheckClusterCliCommand = cli.Command{
+		Name:      "check-cluster",
+		Aliases:   []string{"check"},
+		Usage:     "Check the Docker Engine, static lookup table, Swarm membership, containers and network of each node of a cluster",
+		ArgsUsage: "cluster name",
+		Action:    RunCheckClusterCommand,
+	}
+)
+
+// CheckClusterCommand contain global parameters for the command "check-cluster"
+type CheckClusterCommand struct {
+	cli *cli.Context
+}
+
+// checkCliParameters perform checks on CLI parameters
+func (c *CheckClusterCommand) checkCliParameters() error {
+	// check cluster name
+	if c.cli.NArg() != 1 {
+		return fmt.Errorf("You must provide the name of the cluster to check")
+	}
+
+	return nil
+}
+
+// printChecksMatrix print the pass/fail matrix of the nodes health checks, followed by the failures details
+func printChecksMatrix(out io.Writer, checks []*cluster.NodeCheck) {
+	// output writer with automatic tab handling
+	w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "MACHINE\t%s\n", strings.ToUpper(strings.Join(cluster.CheckNames, "\t")))
+
+	for _, nc := range checks {
+		statuses := []string{}
+		for _, name := range cluster.CheckNames {
+			statuses = append(statuses, string(nc.Results[name].Status))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\n", nc.MachineName, strings.Join(statuses, "\t"))
+	}
+
+	w.Flush()
+
+	// failures details
+	for _, nc := range checks {
+		for _, name := range cluster.CheckNames {
+			if r := nc.Results[name]; r.Status == cluster.CheckFail {
+				fmt.Fprintf(out, "%s: %s: %s\n", nc.MachineName, name, r.Message)
+			}
+		}
+	}
+}
+
+// CheckCluster run the health checks of all the nodes of the cluster
+func (c *CheckClusterCommand) CheckCluster() error {
+	// load cluster state
+	cl, err := cluster.LoadCluster(c.cli.Args().First())
+	if err != nil {
+		return err
+	}
+	defer cl.Config.LibMachineClient.Close()
+
+	log.Infof("Checking the nodes of cluster '%s'...", cl.Name)
+	checks := cl.CheckNodes()
+	if len(checks) == 0 {
+		return fmt.Errorf("The cluster '%s' has no provisionned node", cl.Name)
+	}
+
+	printChecksMatrix(os.Stdout, checks)
+
+	// count failed nodes
+	failedNodes := 0
+	for _, nc := range checks {
+		if nc.Failed() {
+			failedNodes++
+		}
+	}
+
+	if failedNodes > 0 {
+		return fmt.Errorf("%d of %d node(s) failed the health checks", failedNodes, len(checks))
+	}
+
+	return nil
+}
+
+// RunCheckClusterCommand check the health of a cluster
+func RunCheckClusterCommand(cli *cli.Context) error {
+	c := CheckClusterCommand{cli: cli}
+
+	// check CLI parameters
+	if err := c.checkCliParameters(); err != nil {
+		return err
+	}
+
+	return c.CheckCluster()
+}
@@ -0,0 +1,37 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+)
+
+func TestPrintChecksMatrix(t *testing.T) {
+	checks := []*cluster.NodeCheck{
+		{MachineName: "exp-lille-0", Results: map[string]cluster.CheckResult{
+			cluster.CheckEngine:     {Status: cluster.CheckPass},
+			cluster.CheckHosts:      {Status: cluster.CheckPass},
+			cluster.CheckSwarm:      {Status: cluster.CheckPass},
+			cluster.CheckContainers: {Status: cluster.CheckPass},
+			cluster.CheckNetwork:    {Status: cluster.CheckPass},
+		}},
+		{MachineName: "exp-lille-1", Results: map[string]cluster.CheckResult{
+			cluster.CheckEngine:     {Status: cluster.CheckPass},
+			cluster.CheckHosts:      {Status: cluster.CheckFail, Message: "Missing or outdated entries: exp-lille-2"},
+			cluster.CheckSwarm:      {Status: cluster.CheckPass},
+			cluster.CheckContainers: {Status: cluster.CheckPass},
+			cluster.CheckNetwork:    {Status: cluster.CheckFail, Message: "Unreachable nodes: exp-lille-2"},
+		}},
+	}
+
+	var buf bytes.Buffer
+	printChecksMatrix(&buf, checks)
+	assert.Contains(t, buf.String(), "ENGINE")
+	assert.Contains(t, buf.String(), "NETWORK")
+	assert.Contains(t, buf.String(), "exp-lille-1: hosts: Missing or outdated entries: exp-lille-2")
+	assert.Contains(t, buf.String(), "exp-lille-1: network: Unreachable nodes: exp-lille-2")
+	assert.NotContains(t, buf.String(), "exp-lille-0: ")
+}
@@ -0,0 +1,174 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ClusterSpec represents a declarative cluster description (YAML or JSON) usable with the "create-cluster" command
+type ClusterSpec struct {
+	Name string `yaml:"name"`
+
+	G5k struct {
+		Username           string         `yaml:"username"`
+		Password           string         `yaml:"password"`
+		ReserveNodes       map[string]int `yaml:"reserve-nodes"`
+		Walltime           string         `yaml:"walltime"`
+		Image              string         `yaml:"image"`
+		ResourceProperties string         `yaml:"resource-properties"`
+		Reservation        string         `yaml:"reservation"`
+		CoAllocation       bool           `yaml:"co-allocation"`
+	} `yaml:"g5k"`
+
+	Engine struct {
+		InstallURL string              `yaml:"install-url"`
+		Opt        map[string][]string `yaml:"opt"`
+		Label      map[string][]string `yaml:"label"`
+	} `yaml:"engine"`
+
+	Swarm struct {
+		Type       string   `yaml:"type"`
+		Master     []string `yaml:"master"`
+		Standalone struct {
+			Discovery    string   `yaml:"discovery"`
+			ClusterStore string   `yaml:"cluster-store"`
+			Image        string   `yaml:"image"`
+			Strategy     string   `yaml:"strategy"`
+			Opt          []string `yaml:"opt"`
+			JoinOpt      []string `yaml:"join-opt"`
+		} `yaml:"standalone"`
+	} `yaml:"swarm"`
+
+	WeaveNetworking bool `yaml:"weave-networking"`
+}
+
+// clusterSpecFlag represents a CLI flag and the values set by a cluster spec
+type clusterSpecFlag struct {
+	name   string
+	values []string
+}
+
+// parseClusterSpec parse a cluster spec document (JSON documents are valid YAML documents)
+func parseClusterSpec(data []byte) (*ClusterSpec, error) {
+	var spec ClusterSpec
+	if err := yaml.UnmarshalStrict(data, &spec); err != nil {
+		return nil, fmt.Errorf("Syntax error in cluster spec: '%s'", err)
+	}
+
+	// check Swarm type
+	switch spec.Swarm.Type {
+	case "", "mode", "standalone":
+	default:
+		return nil, fmt.Errorf("Unknown Swarm type in cluster spec: '%s' (supported: 'mode', 'standalone')", spec.Swarm.Type)
+	}
+
+	return &spec, nil
+}
+
+// loadClusterSpecFile read and parse the cluster spec file at the given path
+func loadClusterSpecFile(path string) (*ClusterSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read cluster spec file: '%s'", err)
+	}
+
+	return parseClusterSpec(data)
+}
+
+// nodeParamFlagValues convert a map of node(s) parameters to a list of {nodeName}:paramName=paramValue flag values
+func nodeParamFlagValues(nodesParams map[string][]string) []string {
+	// sort nodes name for a stable output
+	nodes := make([]string, 0, len(nodesParams))
+	for node := range nodesParams {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	values := []string{}
+	for _, node := range nodes {
+		for _, param := range nodesParams[node] {
+			values = append(values, fmt.Sprintf("%s:%s", node, param))
+		}
+	}
+
+	return values
+}
+
+// toFlags returns the CLI flags equivalent to the cluster spec (unset values are omitted)
+func (s *ClusterSpec) toFlags() []clusterSpecFlag {
+	flags := []clusterSpecFlag{}
+
+	// add a flag only if it have values
+	add := func(name string, values ...string) {
+		v := []string{}
+		for _, value := range values {
+			if value != "" {
+				v = append(v, value)
+			}
+		}
+
+		if len(v) > 0 {
+			flags = append(flags, clusterSpecFlag{name: name, values: v})
+		}
+	}
+
+	// cluster
+	add("name", s.Name)
+
+	// Grid'5000
+	add("g5k-username", s.G5k.Username)
+	add("g5k-password", s.G5k.Password)
+
+	sites := make([]string, 0, len(s.G5k.ReserveNodes))
+	for site := range s.G5k.ReserveNodes {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+
+	reservations := []string{}
+	for _, site := range sites {
+		reservations = append(reservations, fmt.Sprintf("%s:%d", site, s.G5k.ReserveNodes[site]))
+	}
+	add("g5k-reserve-nodes", reservations...)
+
+	add("g5k-walltime", s.G5k.Walltime)
+	add("g5k-image", s.G5k.Image)
+	add("g5k-resource-properties", s.G5k.ResourceProperties)
+	add("reservation", s.G5k.Reservation)
+
+	if s.G5k.CoAllocation {
+		add("g5k-co-allocation", "true")
+	}
+
+	// Docker Engine
+	add("engine-install-url", s.Engine.InstallURL)
+	add("engine-opt", nodeParamFlagValues(s.Engine.Opt)...)
+	add("engine-label", nodeParamFlagValues(s.Engine.Label)...)
+
+	// Swarm
+	add("swarm-master", s.Swarm.Master...)
+
+	switch s.Swarm.Type {
+	case "mode":
+		add("swarm-mode-enable", "true")
+	case "standalone":
+		add("swarm-standalone-enable", "true")
+	}
+
+	add("swarm-standalone-discovery", s.Swarm.Standalone.Discovery)
+	add("cluster-store", s.Swarm.Standalone.ClusterStore)
+	add("swarm-standalone-image", s.Swarm.Standalone.Image)
+	add("swarm-standalone-strategy", s.Swarm.Standalone.Strategy)
+	add("swarm-standalone-opt", s.Swarm.Standalone.Opt...)
+	add("swarm-standalone-join-opt", s.Swarm.Standalone.JoinOpt...)
+
+	// Weave networking
+	if s.WeaveNetworking {
+		add("weave-networking", "true")
+	}
+
+	return flags
+}
@@ -0,0 +1,70 @@
+package command
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test parseClusterSpec
+func TestParseClusterSpecEmpty(t *testing.T) {
+	spec, err := parseClusterSpec([]byte(""))
+	assert.NoError(t, err)
+	assert.Empty(t, spec.toFlags())
+}
+
+func TestParseClusterSpecUnknownField(t *testing.T) {
+	_, err := parseClusterSpec([]byte("g5k:\n  unknown: value\n"))
+	assert.Error(t, err)
+}
+
+func TestParseClusterSpecIncorrectSwarmType(t *testing.T) {
+	_, err := parseClusterSpec([]byte("swarm:\n  type: incorrect\n"))
+	assert.Error(t, err)
+}
+
+func TestParseClusterSpecCorrectYAML(t *testing.T) {
+	data := `
+name: myexp
+g5k:
+  username: user
+  reserve-nodes:
+    nantes: 8
+    lille: 16
+  walltime: "2:00:00"
+engine:
+  opt:
+    "lille-{0..15}": ["graph=/tmp"]
+  label:
+    lille-0: ["key1=val1", "key2=val2"]
+swarm:
+  type: standalone
+  master: ["lille-0"]
+weave-networking: true
+`
+	spec, err := parseClusterSpec([]byte(data))
+	assert.NoError(t, err)
+	assert.True(t, reflect.DeepEqual(spec.toFlags(), []clusterSpecFlag{
+		{name: "name", values: []string{"myexp"}},
+		{name: "g5k-username", values: []string{"user"}},
+		{name: "g5k-reserve-nodes", values: []string{"lille:16", "nantes:8"}},
+		{name: "g5k-walltime", values: []string{"2:00:00"}},
+		{name: "engine-opt", values: []string{"lille-{0..15}:graph=/tmp"}},
+		{name: "engine-label", values: []string{"lille-0:key1=val1", "lille-0:key2=val2"}},
+		{name: "swarm-master", values: []string{"lille-0"}},
+		{name: "swarm-standalone-enable", values: []string{"true"}},
+		{name: "weave-networking", values: []string{"true"}},
+	}))
+}
+
+func TestParseClusterSpecCorrectJSON(t *testing.T) {
+	data := `{"g5k": {"reserve-nodes": {"lille": 4}}, "swarm": {"type": "mode", "master": ["lille-{0..2}"]}}`
+	spec, err := parseClusterSpec([]byte(data))
+	assert.NoError(t, err)
+	assert.True(t, reflect.DeepEqual(spec.toFlags(), []clusterSpecFlag{
+		{name: "g5k-reserve-nodes", values: []string{"lille:4"}},
+		{name: "swarm-master", values: []string{"lille-{0..2}"}},
+		{name: "swarm-mode-enable", values: []string{"true"}},
+	}))
+}
@@ -2,7 +2,13 @@ package command
 
 import (
 	"fmt"
+	"io"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/commands/mcndirs"
@@ -11,11 +17,20 @@ import (
 	"github.com/kujtimiihoxha/go-brace-expansion"
 
 	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
 	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/kvstore"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/retry"
 	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
 )
 
 const (
+	// provisionRetryMaxDelay is the maximum delay between two attempts of a node provisionning phase
+	provisionRetryMaxDelay = 2 * time.Minute
+
+	// regexClusterName match the name of a cluster (clusterName), it must start with a letter to not be confused with a job ID
+	regexClusterName = "^(?P<clusterName>[[:alpha:]][[:alnum:]-]*)$"
+
 	// regexNodeName match the site (nodeSite) and the ID (nodeID) of a node from its name (nodeName)
 	regexNodeName = "(?P<nodeName>(?P<nodeSite>[[:alpha:]]+)-(?P<nodeID>[[:digit:]]+))"
 
@@ -33,7 +48,28 @@ var (
 		Aliases: []string{"create", "c"},
 		Usage:   "Create a new Docker Swarm cluster on the Grid'5000 infrastructure",
 		Action:  RunCreateClusterCommand,
-		Flags: []cli.Flag{
+		Flags: append([]cli.Flag{
+			cli.StringFlag{
+				EnvVar: "G5K_CLUSTER_FILE",
+				Name:   "file",
+				Usage:  "Cluster spec file (YAML or JSON), flags given on the command line override its values",
+				Value:  "",
+			},
+
+			cli.StringFlag{
+				EnvVar: "G5K_CLUSTER_NAME",
+				Name:   "name",
+				Usage:  "Name of the cluster, used as prefix of the machines name (Default: generated from the current date)",
+				Value:  "",
+			},
+
+			cli.StringFlag{
+				EnvVar: "G5K_RESUME",
+				Name:   "resume",
+				Usage:  "Resume the creation of the given cluster (only the phases not completed are done)",
+				Value:  "",
+			},
+
 			cli.StringFlag{
 				EnvVar: "G5K_USERNAME",
 				Name:   "g5k-username",
@@ -75,6 +111,26 @@ var (
 				Value:  "",
 			},
 
+			cli.StringFlag{
+				EnvVar: "G5K_RESERVATION",
+				Name:   "reservation",
+				Usage:  "Submit advance reservations starting at the given date (YYYY-MM-DD hh:mm:ss), the cluster is deployed later with 'deploy-cluster'",
+				Value:  "",
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_CO_ALLOCATION",
+				Name:   "g5k-co-allocation",
+				Usage:  "Reserve the nodes of all sites with the same start date (all or nothing)",
+			},
+
+			cli.DurationFlag{
+				EnvVar: "G5K_CO_ALLOCATION_DELAY",
+				Name:   "g5k-co-allocation-delay",
+				Usage:  "Delay before the start date of co-allocated jobs",
+				Value:  5 * time.Minute,
+			},
+
 			cli.StringFlag{
 				EnvVar: "ENGINE_INSTALL_URL",
 				Name:   "engine-install-url",
@@ -115,10 +171,17 @@ var (
 			cli.StringFlag{
 				EnvVar: "SWARM_STANDALONE_DISCOVERY",
 				Name:   "swarm-standalone-discovery",
-				Usage:  "Discovery service to use with Swarm (Default: Start a Zookeeper service on all master nodes)",
+				Usage:  "Discovery service to use with Swarm (Default: Start the cluster store on all master nodes)",
 				Value:  "",
 			},
 
+			cli.StringFlag{
+				EnvVar: "CLUSTER_STORE",
+				Name:   "cluster-store",
+				Usage:  "Cluster store to start on all master nodes if no Swarm discovery service is provided : " + strings.Join(kvstore.Names(), ", "),
+				Value:  "zookeeper",
+			},
+
 			cli.StringFlag{
 				EnvVar: "SWARM_STANDALONE_IMAGE",
 				Name:   "swarm-standalone-image",
@@ -150,13 +213,20 @@ var (
 				Name:   "weave-networking",
 				Usage:  "Use Weave for networking (Only if Swarm standalone is enabled)",
 			},
-		},
+		}, clusterBuildFlags...),
 	}
 )
 
 // CreateClusterCommand contain global parameters for the command "create-cluster"
 type CreateClusterCommand struct {
 	cli *cli.Context
+
+	// reserve the nodes of all sites at the same time (only available when creating a cluster)
+	coAllocation bool
+
+	// jobs submitted by this command (killed on rollback)
+	createdJobs     []*cluster.Job
+	createdJobsLock sync.Mutex
 }
 
 // parseReserveNodesFlag parse the nodes reservation flag (site):(number of nodes)
@@ -250,8 +320,67 @@ func (c *CreateClusterCommand) parseEngineLabelFlag(flag []string) (map[string][
 	return nodesEngineLabel, nil
 }
 
+// applyClusterSpec set the CLI flags from a cluster spec (flags given on the command line take precedence)
+func (c *CreateClusterCommand) applyClusterSpec(spec *ClusterSpec) error {
+	// the Swarm type given on the command line replace the one from the spec
+	swarmTypeIsSet := c.cli.IsSet("swarm-mode-enable") || c.cli.IsSet("swarm-standalone-enable")
+
+	for _, f := range spec.toFlags() {
+		// skip flags given on the command line
+		if c.cli.IsSet(f.name) {
+			continue
+		}
+
+		// skip the Swarm type of the spec if one is given on the command line
+		if swarmTypeIsSet && (f.name == "swarm-mode-enable" || f.name == "swarm-standalone-enable") {
+			continue
+		}
+
+		for _, v := range f.values {
+			if err := c.cli.Set(f.name, v); err != nil {
+				return fmt.Errorf("Unable to set the '%s' flag from the cluster spec: '%s'", f.name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkCreationParameters perform checks on the CLI parameters changing the cluster creation behavior (also used when resuming)
+func (c *CreateClusterCommand) checkCreationParameters() error {
+	// check the flags shared with the other commands building a cluster
+	if err := checkClusterBuildParameters(c.cli); err != nil {
+		return err
+	}
+
+	// check co-allocation parameters
+	if c.cli.Bool("g5k-co-allocation") {
+		// block continuing without a site (co-allocation is all or nothing)
+		if c.cli.String("site-failure-policy") == "continue" {
+			return fmt.Errorf("You can't continue without the failed sites with co-allocation")
+		}
+
+		if c.cli.Duration("g5k-co-allocation-delay") <= 0 {
+			return fmt.Errorf("You must provide a positive co-allocation delay")
+		}
+	}
+
+	return nil
+}
+
 // checkCliParameters perform checks on CLI parameters
 func (c *CreateClusterCommand) checkCliParameters() error {
+	// check cluster name
+	if c.cli.String("name") != "" {
+		if _, err := ParseCliFlag(regexClusterName, c.cli.String("name")); err != nil {
+			return fmt.Errorf("Syntax error in cluster name: '%s' (it must start with a letter and contain only letters, digits and '-')", c.cli.String("name"))
+		}
+
+		if cluster.Exists(c.cli.String("name")) {
+			return fmt.Errorf("The cluster '%s' already exists", c.cli.String("name"))
+		}
+	}
+
 	// check username
 	if c.cli.String("g5k-username") == "" {
 		return fmt.Errorf("You must provide your Grid5000 account username")
@@ -277,6 +406,23 @@ func (c *CreateClusterCommand) checkCliParameters() error {
 		return fmt.Errorf("You must provide a walltime")
 	}
 
+	// check advance reservation start date
+	if c.cli.String("reservation") != "" {
+		date, err := g5k.ParseReservationDate(c.cli.String("reservation"))
+		if err != nil {
+			return fmt.Errorf("Syntax error in reservation start date: '%s' (format: 'YYYY-MM-DD hh:mm:ss')", c.cli.String("reservation"))
+		}
+
+		if !date.After(time.Now()) {
+			return fmt.Errorf("The reservation start date must be in the future: '%s'", c.cli.String("reservation"))
+		}
+
+		// block co-allocation (all the jobs already start at the given date)
+		if c.cli.Bool("g5k-co-allocation") {
+			return fmt.Errorf("You can't use co-allocation with an advance reservation (all the jobs start at the reservation date)")
+		}
+	}
+
 	// check Docker Engine install url
 	if c.cli.String("engine-install-url") == "" {
 		return fmt.Errorf("You must provide a Docker Engine install URL")
@@ -300,6 +446,11 @@ func (c *CreateClusterCommand) checkCliParameters() error {
 		if c.cli.String("swarm-standalone-strategy") == "" {
 			return fmt.Errorf("You must provide a Swarm strategy")
 		}
+
+		// check cluster store
+		if _, err := kvstore.Get(c.cli.String("cluster-store")); err != nil {
+			return err
+		}
 	}
 
 	// check Swarm Mode parameters
@@ -318,6 +469,11 @@ func (c *CreateClusterCommand) checkCliParameters() error {
 	return nil
 }
 
+// generateClusterName returns a new cluster name based on the current date
+func generateClusterName() string {
+	return fmt.Sprintf("cluster-%s", time.Now().Format("20060102-150405"))
+}
+
 // generateClusterConfig generate a cluster configuration from cli parameters
 func (c *CreateClusterCommand) configureCluster() (*cluster.GlobalConfig, error) {
 	// create nodes global configuration
@@ -328,6 +484,7 @@ func (c *CreateClusterCommand) configureCluster() (*cluster.GlobalConfig, error)
 		G5kPassword:            c.cli.String("g5k-password"),
 		G5kImage:               c.cli.String("g5k-image"),
 		G5kWalltime:            c.cli.String("g5k-walltime"),
+		G5kResourceProperties:  c.cli.String("g5k-resource-properties"),
 		WeaveNetworkingEnabled: c.cli.Bool("weave-networking"),
 		HostsLookupTable:       make(map[string]string),
 	}
@@ -342,6 +499,11 @@ func (c *CreateClusterCommand) configureCluster() (*cluster.GlobalConfig, error)
 			MasterFlags: c.cli.StringSlice("swarm-standalone-opt"),
 			JoinFlags:   c.cli.StringSlice("swarm-standalone-join-opt"),
 		}
+
+		// the cluster store is deployed on the master nodes if no discovery service is provided
+		if clusterConfig.SwarmStandaloneGlobalConfig.Discovery == "" {
+			clusterConfig.ClusterStore = c.cli.String("cluster-store")
+		}
 	}
 
 	// enable Swarm Mode
@@ -368,8 +530,14 @@ func (c *CreateClusterCommand) createCluster() error {
 		return err
 	}
 
+	// use the given cluster name or generate a new one
+	clusterName := c.cli.String("name")
+	if clusterName == "" {
+		clusterName = generateClusterName()
+	}
+
 	// create new cluster
-	cluster := cluster.NewCluster(clusterConfig)
+	cluster := cluster.NewCluster(clusterName, clusterConfig)
 	defer cluster.Config.LibMachineClient.Close()
 
 	// parse nodes reservation
@@ -394,11 +562,12 @@ func (c *CreateClusterCommand) createCluster() error {
 
 	// apply engine options to nodes
 	for node, opts := range engineOpts {
-		if _, ok := cluster.Nodes[node]; !ok {
+		machineName := cluster.GetMachineName(node)
+		if _, ok := cluster.Nodes[machineName]; !ok {
 			return fmt.Errorf("The node '%s' does not exist", node)
 		}
 
-		cluster.Nodes[node].EngineOpt = append(cluster.Nodes[node].EngineOpt, opts...)
+		cluster.Nodes[machineName].EngineOpt = append(cluster.Nodes[machineName].EngineOpt, opts...)
 	}
 
 	// parse engine label
@@ -409,11 +578,12 @@ func (c *CreateClusterCommand) createCluster() error {
 
 	// apply engine labels to nodes
 	for node, labels := range engineLabels {
-		if _, ok := cluster.Nodes[node]; !ok {
+		machineName := cluster.GetMachineName(node)
+		if _, ok := cluster.Nodes[machineName]; !ok {
 			return fmt.Errorf("The node '%s' does not exist", node)
 		}
 
-		cluster.Nodes[node].EngineLabel = append(cluster.Nodes[node].EngineLabel, labels...)
+		cluster.Nodes[machineName].EngineLabel = append(cluster.Nodes[machineName].EngineLabel, labels...)
 	}
 
 	// parse Swarm master flag
@@ -424,40 +594,534 @@ func (c *CreateClusterCommand) createCluster() error {
 
 	// store swarm master nodes
 	for node := range swarmMaster {
-		if _, ok := cluster.Nodes[node]; !ok {
+		machineName := cluster.GetMachineName(node)
+		if _, ok := cluster.Nodes[machineName]; !ok {
 			return fmt.Errorf("The node '%s' does not exist", node)
 		}
 
-		cluster.Config.SwarmMasterNode = append(cluster.Config.SwarmMasterNode, node)
+		cluster.Config.SwarmMasterNode = append(cluster.Config.SwarmMasterNode, machineName)
+	}
+
+	// add the jobs to reserve to the cluster (sorted by site for a stable order)
+	sites := make([]string, 0, len(nodesReservation))
+	for site := range nodesReservation {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+
+	for _, site := range sites {
+		j := cluster.AddJob(site, nodesReservation[site])
+		j.Reservation = c.cli.String("reservation")
+	}
+
+	// save the initial cluster state
+	if err := cluster.Save(); err != nil {
+		return err
+	}
+
+	// only submit the advance reservations
+	if c.cli.String("reservation") != "" {
+		return c.submitAdvanceReservations(g5kAPI, cluster)
+	}
+
+	log.Infof("Creating cluster '%s'...", cluster.Name)
+
+	return c.buildCluster(g5kAPI, cluster, true)
+}
+
+// resumeCluster resume the creation of an existing cluster from its state
+func (c *CreateClusterCommand) resumeCluster(name string) error {
+	// load cluster state
+	cluster, err := cluster.LoadCluster(name)
+	if err != nil {
+		return err
+	}
+	defer cluster.Config.LibMachineClient.Close()
+
+	// create Grid5000 API client using the cluster credentials
+	g5kAPI := g5k.Init(cluster.Config.G5kUsername, cluster.Config.G5kPassword)
+
+	// Check VPN connection for all sites of the cluster
+	nodesReservation := make(map[string]int)
+	for _, j := range cluster.Jobs {
+		nodesReservation[j.Site] += j.NbNodes
+	}
+
+	if err := g5kAPI.CheckVpnConnection(nodesReservation); err != nil {
+		return err
+	}
+
+	log.Infof("Resuming the creation of cluster '%s'...", cluster.Name)
+
+	return c.buildCluster(g5kAPI, cluster, false)
+}
+
+// submitJob submit the reservation of a job and store its ID in the cluster state
+func (c *CreateClusterCommand) submitJob(g5kAPI *g5k.G5K, cl *cluster.Cluster, j *cluster.Job) error {
+	if j.Reservation != "" {
+		log.Infof("Reserving %d nodes on '%s' site starting at '%s'...", j.NbNodes, j.Site, j.Reservation)
+	} else {
+		log.Infof("Reserving %d nodes on '%s' site...", j.NbNodes, j.Site)
+	}
+
+	jobID, err := g5kAPI.SubmitNodesReservation(j.Site, j.NbNodes, cl.Config.G5kResourceProperties, cl.Config.G5kWalltime, j.Reservation)
+	if err != nil {
+		return fmt.Errorf("Job reservation for site '%s' failed: '%s'", j.Site, err)
+	}
+
+	// store the job ID before waiting, the job will be reused if the creation is interrupted
+	c.createdJobsLock.Lock()
+	c.createdJobs = append(c.createdJobs, j)
+	c.createdJobsLock.Unlock()
+
+	return cl.UpdateJob(j, func(j *cluster.Job) {
+		j.ID = jobID
+		j.Phase = cluster.JobPhaseSubmitted
+	})
+}
+
+// submitAdvanceReservations submit the advance reservations of the jobs, the cluster will be deployed by the "deploy-cluster" command
+func (c *CreateClusterCommand) submitAdvanceReservations(g5kAPI *g5k.G5K, cl *cluster.Cluster) error {
+	for _, j := range cl.Jobs {
+		if j.Phase != cluster.JobPhaseNone {
+			continue
+		}
+
+		if err := c.submitJob(g5kAPI, cl, j); err != nil {
+			if c.cli.Bool("rollback-on-failure") {
+				log.Error(err)
+				c.rollbackCluster(g5kAPI, cl, true)
+			}
+
+			return err
+		}
+
+		log.Infof("Job '%d' submitted on '%s' site", j.ID, j.Site)
+	}
+
+	log.Infof("Cluster '%s' reserved, run 'deploy-cluster %s' to deploy it once the jobs are started", cl.Name, cl.Name)
+
+	return nil
+}
+
+// processJob reserve, deploy and allocate the nodes of a job (only the phases not already completed are done)
+func (c *CreateClusterCommand) processJob(g5kAPI *g5k.G5K, cl *cluster.Cluster, j *cluster.Job) error {
+	// submit the job
+	if j.Phase == cluster.JobPhaseNone {
+		if err := c.submitJob(g5kAPI, cl, j); err != nil {
+			return err
+		}
+	}
+
+	// wait until the job is ready
+	if j.Phase == cluster.JobPhaseSubmitted {
+		log.Infof("Waiting for job '%d' on '%s' site...", j.ID, j.Site)
+
+		if err := g5kAPI.WaitUntilJobIsReady(j.Site, j.ID); err != nil {
+			return fmt.Errorf("Job reservation for site '%s' failed: '%s'", j.Site, err)
+		}
+
+		if err := cl.SetJobPhase(j, cluster.JobPhaseReserved); err != nil {
+			return err
+		}
+	}
+
+	// deploy nodes
+	if j.Phase == cluster.JobPhaseReserved {
+		log.Infof("Deploying %d nodes on '%s' site...", j.NbNodes, j.Site)
+
+		deployedNodes, err := g5kAPI.DeployNodes(j.Site, string(cl.Config.SSHKeyPair.PublicKey), j.ID, cl.Config.G5kImage)
+		if err != nil {
+			return fmt.Errorf("Nodes deployment for site '%s' failed: '%s'", j.Site, err)
+		}
+
+		if err := cl.UpdateJob(j, func(j *cluster.Job) {
+			j.DeployedNodes = deployedNodes
+			j.Phase = cluster.JobPhaseDeployed
+		}); err != nil {
+			return err
+		}
+	}
+
+	// allocate deployed nodes to machines
+	if j.Phase == cluster.JobPhaseDeployed {
+		if err := cl.AllocateDeployedNodesToMachines(j.Site, j.ID, j.DeployedNodes); err != nil {
+			return fmt.Errorf("Unable to allocate deployed nodes to machines for site '%s' : '%s'", j.Site, err)
+		}
+
+		if err := cl.SetJobPhase(j, cluster.JobPhaseAllocated); err != nil {
+			return err
+		}
+
+		log.Infof("Site '%s' is ready (%d nodes deployed)", j.Site, len(j.DeployedNodes))
+	}
+
+	return nil
+}
+
+// coAllocateJobs submit all the jobs not submitted yet with the same start date, then wait until they are all ready
+// If a job can't be submitted, the submitted jobs are killed without waiting, and if a job is not ready, all the co-allocated jobs are killed
+func (c *CreateClusterCommand) coAllocateJobs(g5kAPI *g5k.G5K, cl *cluster.Cluster) error {
+	// the shared start date leaves enough time to submit the jobs on all sites
+	startDate := g5k.FormatReservationDate(time.Now().Add(c.cli.Duration("g5k-co-allocation-delay")))
+
+	// select the jobs to co-allocate
+	jobs := []*cluster.Job{}
+	for _, j := range cl.Jobs {
+		if j.Phase == cluster.JobPhaseNone {
+			jobs = append(jobs, j)
+		}
+	}
+
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	log.Infof("Co-allocating %d job(s) starting at '%s'...", len(jobs), startDate)
+
+	// submit the advance reservations (parallel)
+	var wg sync.WaitGroup
+	jobsErr := make([]error, len(jobs))
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j *cluster.Job) {
+			defer wg.Done()
+
+			jobID, err := g5kAPI.SubmitNodesReservation(j.Site, j.NbNodes, cl.Config.G5kResourceProperties, cl.Config.G5kWalltime, startDate)
+			if err != nil {
+				jobsErr[i] = fmt.Errorf("Job reservation for site '%s' failed: '%s'", j.Site, err)
+				return
+			}
+
+			jobsErr[i] = cl.UpdateJob(j, func(j *cluster.Job) {
+				j.ID = jobID
+				j.Reservation = startDate
+				j.Phase = cluster.JobPhaseSubmitted
+			})
+		}(i, j)
+	}
+
+	// wait all the jobs to be submitted, the submitted jobs are killed right away if a submission failed
+	wg.Wait()
+	if err := c.checkCoAllocatedJobs(g5kAPI, cl, jobs, jobsErr); err != nil {
+		return err
+	}
+
+	// wait until the jobs are ready (parallel)
+	for i, j := range jobs {
+		wg.Add(1)
+		go func(i int, j *cluster.Job) {
+			defer wg.Done()
+
+			log.Infof("Waiting for job '%d' on '%s' site...", j.ID, j.Site)
+
+			if err := g5kAPI.WaitUntilJobIsReady(j.Site, j.ID); err != nil {
+				jobsErr[i] = fmt.Errorf("Job reservation for site '%s' failed: '%s'", j.Site, err)
+				return
+			}
+
+			jobsErr[i] = cl.SetJobPhase(j, cluster.JobPhaseReserved)
+		}(i, j)
 	}
 
-	// process nodes reservations by sites
-	for site, nb := range nodesReservation {
-		log.Infof("Reserving %d nodes on '%s' site...", nb, site)
+	// wait all sites to be reserved
+	wg.Wait()
+	if err := c.checkCoAllocatedJobs(g5kAPI, cl, jobs, jobsErr); err != nil {
+		return err
+	}
+
+	// all the sites are ready
+	c.createdJobsLock.Lock()
+	c.createdJobs = append(c.createdJobs, jobs...)
+	c.createdJobsLock.Unlock()
+
+	return nil
+}
 
-		// reserve nodes
-		jobID, err := g5kAPI.ReserveNodes(site, nb, c.cli.String("g5k-resource-properties"), c.cli.String("g5k-walltime"))
+// checkCoAllocatedJobs kill all the co-allocated jobs and returns an error if one of them failed
+func (c *CreateClusterCommand) checkCoAllocatedJobs(g5kAPI *g5k.G5K, cl *cluster.Cluster, jobs []*cluster.Job, jobsErr []error) error {
+	// aggregate sites errors
+	failedSites := []string{}
+	for i, err := range jobsErr {
 		if err != nil {
-			return fmt.Errorf("Job reservation for site '%s' failed: '%s'", site, err)
+			failedSites = append(failedSites, fmt.Sprintf("site '%s': %s", jobs[i].Site, err))
+		}
+	}
+
+	if len(failedSites) == 0 {
+		return nil
+	}
+
+	// kill all the co-allocated jobs
+	for _, j := range jobs {
+		if j.ID == 0 {
+			continue
+		}
+
+		if err := g5kAPI.KillJob(j.Site, j.ID); err != nil {
+			log.Errorf("Unable to kill job '%d' on site '%s': %s", j.ID, j.Site, err)
+		} else {
+			log.Infof("Job '%d' on site '%s' killed", j.ID, j.Site)
 		}
 
-		// deploy nodes
-		deployedNodes, err := g5kAPI.DeployNodes(site, string(cluster.Config.SSHKeyPair.PublicKey), jobID, c.cli.String("g5k-image"))
+		cl.ResetJob(j)
+	}
+
+	if err := cl.Save(); err != nil {
+		return err
+	}
+
+	return fmt.Errorf("Co-allocation failed on %d site(s): %s", len(failedSites), strings.Join(failedSites, " ; "))
+}
+
+// runClusterPhases run the phases of the cluster creation not already completed (reserve, deploy, allocate and provision), and returns the provisionning result of the nodes
+func (c *CreateClusterCommand) runClusterPhases(g5kAPI *g5k.G5K, cl *cluster.Cluster) ([]cluster.NodeResult, error) {
+	// reserve the nodes of all sites at the same time
+	if c.coAllocation {
+		if err := c.coAllocateJobs(g5kAPI, cl); err != nil {
+			return nil, err
+		}
+	}
+
+	// process nodes reservations by sites (parallel)
+	var wg sync.WaitGroup
+	jobsErr := make([]error, len(cl.Jobs))
+	for i, j := range cl.Jobs {
+		wg.Add(1)
+		go func(i int, j *cluster.Job) {
+			defer wg.Done()
+			if err := c.processJob(g5kAPI, cl, j); err != nil {
+				log.Errorf("Site '%s' failed: %s", j.Site, err)
+				jobsErr[i] = err
+			}
+		}(i, j)
+	}
+
+	// wait all sites to be reserved and deployed
+	wg.Wait()
+
+	// aggregate sites errors
+	failedSites := []string{}
+	for i, err := range jobsErr {
 		if err != nil {
-			return fmt.Errorf("Nodes deployment for site '%s' failed: '%s'", site, err)
+			failedSites = append(failedSites, fmt.Sprintf("site '%s': %s", cl.Jobs[i].Site, err))
 		}
+	}
 
-		// allocate deployed nodes to machines
-		if err := cluster.AllocateDeployedNodesToMachines(site, jobID, deployedNodes); err != nil {
-			return fmt.Errorf("Unable to allocate deployed nodes to machines for site '%s' : '%s'", site, err)
+	if len(failedSites) > 0 {
+		// by default, all the sites are required to continue
+		if c.cli.String("site-failure-policy") != "continue" || len(failedSites) == len(cl.Jobs) {
+			return nil, fmt.Errorf("Cluster creation failed on %d site(s): %s", len(failedSites), strings.Join(failedSites, " ; "))
 		}
+
+		log.Warnf("Continuing without %d failed site(s), use '--resume %s' to retry them", len(failedSites), cl.Name)
 	}
 
 	// provision deployed nodes
-	if err := cluster.ProvisionNodes(); err != nil {
+	return cl.ProvisionNodes()
+}
+
+// printProvisionReport print the provisionning result of each node
+func printProvisionReport(out io.Writer, results []cluster.NodeResult) {
+	// output writer with automatic tab handling
+	w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "NODE\tMACHINE\tPHASE\tERROR\n")
+
+	for _, r := range results {
+		nodeName := r.NodeName
+		if nodeName == "" {
+			nodeName = "-"
+		}
+
+		errMsg := "-"
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", nodeName, r.MachineName, r.Phase, errMsg)
+	}
+
+	w.Flush()
+}
+
+// parseMaxFailedNodes returns the maximum number of failed nodes from a number of nodes (ex: 2) or a percentage of the total number of nodes (ex: 10%)
+func parseMaxFailedNodes(value string, total int) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	// percentage of the total number of nodes
+	if strings.HasSuffix(value, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("Syntax error in maximum number of failed nodes: '%s'", value)
+		}
+
+		return int(float64(total) * p / 100), nil
+	}
+
+	// number of nodes
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Syntax error in maximum number of failed nodes: '%s'", value)
+	}
+
+	return n, nil
+}
+
+// countFailedNodes returns the number of nodes not provisioned and the total number of nodes, excluding the nodes of the skipped sites
+func countFailedNodes(results []cluster.NodeResult) (int, int) {
+	failed, total := 0, 0
+	for _, r := range results {
+		if r.Skipped() {
+			continue
+		}
+
+		total++
+		if r.Failed() {
+			failed++
+		}
+	}
+
+	return failed, total
+}
+
+// checkFailedNodes returns an error if the number of nodes not provisioned is above the maximum number of failed nodes
+func (c *CreateClusterCommand) checkFailedNodes(cl *cluster.Cluster, results []cluster.NodeResult) error {
+	failed, total := countFailedNodes(results)
+	if failed == 0 {
+		return nil
+	}
+
+	maxFailed, err := parseMaxFailedNodes(c.cli.String("max-failed-nodes"), total)
+	if err != nil {
 		return err
 	}
 
+	if failed > maxFailed {
+		return fmt.Errorf("Provisionning failed on %d/%d node(s) (maximum allowed: %d)", failed, total, maxFailed)
+	}
+
+	log.Warnf("Provisionning failed on %d/%d node(s) (maximum allowed: %d), use '--resume %s' to retry them", failed, total, maxFailed, cl.Name)
+	return nil
+}
+
+// rollbackCluster kill the jobs submitted by this command and remove the machines it created, then print a summary
+func (c *CreateClusterCommand) rollbackCluster(g5kAPI *g5k.G5K, cl *cluster.Cluster, isNewCluster bool) {
+	log.Warn("Rolling back the cluster creation...")
+
+	killedJobs := []string{}
+	removedMachines := []string{}
+	failures := []string{}
+
+	// jobs submitted by this command
+	createdJobIDs := make(map[int]bool)
+	for _, j := range c.createdJobs {
+		createdJobIDs[j.ID] = true
+	}
+
+	// remove the machines of the submitted jobs, and the machines created by this command for the jobs of a resumed creation
+	for _, n := range cl.Nodes {
+		if !createdJobIDs[n.G5kJobID] && !n.IsCreatedByCurrentRun() {
+			continue
+		}
+
+		if exists, err := cl.Config.LibMachineClient.Exists(n.MachineName); err != nil || !exists {
+			continue
+		}
+
+		if err := cl.Config.LibMachineClient.Remove(n.MachineName); err != nil {
+			failures = append(failures, fmt.Sprintf("machine '%s': %s", n.MachineName, err))
+			continue
+		}
+
+		removedMachines = append(removedMachines, n.MachineName)
+
+		// the node of a previous job will be provisionned again if the cluster creation is resumed
+		if !createdJobIDs[n.G5kJobID] {
+			cl.ResetNode(n)
+		}
+	}
+
+	for _, j := range c.createdJobs {
+		// kill the job
+		if err := g5kAPI.KillJob(j.Site, j.ID); err != nil {
+			failures = append(failures, fmt.Sprintf("job '%d' on site '%s': %s", j.ID, j.Site, err))
+		} else {
+			killedJobs = append(killedJobs, fmt.Sprintf("%d (%s)", j.ID, j.Site))
+		}
+
+		// the job will be reserved again if the cluster creation is resumed
+		cl.ResetJob(j)
+	}
+
+	// a new cluster is entirely removed, a resumed cluster keeps the state of its previous jobs
+	if isNewCluster {
+		if err := cl.RemoveState(); err != nil {
+			failures = append(failures, fmt.Sprintf("cluster state: %s", err))
+		}
+	} else {
+		if err := cl.Save(); err != nil {
+			failures = append(failures, fmt.Sprintf("cluster state: %s", err))
+		}
+	}
+
+	// print rollback summary
+	sort.Strings(removedMachines)
+	log.Infof("Rollback summary for cluster '%s':", cl.Name)
+	log.Infof("  Killed job(s): %s", strings.Join(killedJobs, ", "))
+	log.Infof("  Removed machine(s): %s", strings.Join(removedMachines, ", "))
+	for _, f := range failures {
+		log.Errorf("  Failed to clean up %s", f)
+	}
+}
+
+// buildCluster run the cluster creation, and rollback the changes on failure if enabled
+func (c *CreateClusterCommand) buildCluster(g5kAPI *g5k.G5K, cl *cluster.Cluster, isNewCluster bool) error {
+	// the retry policy is not stored in the cluster state
+	cl.Config.ProvisionRetryPolicy = retry.Policy{
+		Attempts:     c.cli.Int("provision-attempts"),
+		InitialDelay: c.cli.Duration("provision-retry-delay"),
+		MaxDelay:     provisionRetryMaxDelay,
+	}
+
+	// the provisionning parallelism is not stored in the cluster state
+	cl.Config.ProvisionParallelism = c.cli.Int("provision-parallelism")
+	cl.Config.ProvisionSiteParallelism = c.cli.Int("provision-site-parallelism")
+
+	// report the cluster creation progress
+	progress, err := startProgressReporter(c.cli.String("progress"), cl.Name, c.cli.String("events"), c.cli.String("events-file"))
+	if err != nil {
+		return err
+	}
+	defer progress.close()
+	cl.Config.Events = progress.emitter
+	g5kAPI.SetEventsEmitter(progress.emitter)
+
+	results, err := c.runClusterPhases(g5kAPI, cl)
+	progress.stop()
+
+	// print the provisionning result of the nodes and check the number of failed nodes
+	if len(results) > 0 {
+		printProvisionReport(reportWriter(c.cli.String("events"), c.cli.String("events-file")), results)
+	}
+
+	if err == nil {
+		err = c.checkFailedNodes(cl, results)
+	}
+
+	if err != nil {
+		if c.cli.Bool("rollback-on-failure") {
+			log.Error(err)
+			c.rollbackCluster(g5kAPI, cl, isNewCluster)
+		}
+
+		return err
+	}
+
+	log.Infof("Cluster '%s' created", cl.Name)
+	progress.emitter.Emit(events.Event{Type: events.ClusterReady})
+
 	return nil
 }
 
@@ -465,6 +1129,29 @@ func (c *CreateClusterCommand) createCluster() error {
 func RunCreateClusterCommand(cli *cli.Context) error {
 	c := CreateClusterCommand{cli: cli}
 
+	// load cluster spec file (not used when resuming, the parameters are loaded from the cluster state)
+	if c.cli.String("file") != "" && c.cli.String("resume") == "" {
+		spec, err := loadClusterSpecFile(c.cli.String("file"))
+		if err != nil {
+			return err
+		}
+
+		if err := c.applyClusterSpec(spec); err != nil {
+			return err
+		}
+	}
+
+	// check cluster creation behavior parameters
+	if err := c.checkCreationParameters(); err != nil {
+		return err
+	}
+	c.coAllocation = c.cli.Bool("g5k-co-allocation")
+
+	// resume the creation of an existing cluster (the other parameters are loaded from the cluster state)
+	if c.cli.String("resume") != "" {
+		return c.resumeCluster(c.cli.String("resume"))
+	}
+
 	// check CLI parameters
 	if err := c.checkCliParameters(); err != nil {
 		return err
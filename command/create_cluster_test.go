@@ -1,9 +1,14 @@
 package command
 
 import (
+	"flag"
+	"os"
 	"reflect"
 	"testing"
 
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/codegangsta/cli"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -170,3 +175,115 @@ func TestParseEngineLabelFlagCorrectNodeNameMultipleOptMultipleValue(t *testing.
 		"site-2": []string{"key=val"},
 	}))
 }
+
+// Test parseMaxFailedNodes
+func TestParseMaxFailedNodesEmpty(t *testing.T) {
+	n, err := parseMaxFailedNodes("", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestParseMaxFailedNodesNumber(t *testing.T) {
+	n, err := parseMaxFailedNodes("3", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+}
+
+func TestParseMaxFailedNodesPercentage(t *testing.T) {
+	n, err := parseMaxFailedNodes("25%", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, n)
+}
+
+func TestParseMaxFailedNodesIncorrectPercentage(t *testing.T) {
+	_, err := parseMaxFailedNodes("150%", 10)
+	assert.Error(t, err)
+}
+
+func TestParseMaxFailedNodesNegative(t *testing.T) {
+	_, err := parseMaxFailedNodes("-1", 10)
+	assert.Error(t, err)
+}
+
+// Test countFailedNodes
+func TestCountFailedNodesSkippedSite(t *testing.T) {
+	results := []cluster.NodeResult{
+		{MachineName: "test-lille-0", Phase: cluster.NodePhaseProvisioned},
+		{MachineName: "test-nantes-0", Phase: cluster.NodePhaseSkipped},
+		{MachineName: "test-nantes-1", Phase: cluster.NodePhaseSkipped},
+	}
+
+	// the nodes of a site skipped with '--site-failure-policy continue' are not counted with the default '--max-failed-nodes'
+	failed, total := countFailedNodes(results)
+	assert.Equal(t, 0, failed)
+	assert.Equal(t, 1, total)
+
+	maxFailed, err := parseMaxFailedNodes("0", total)
+	assert.NoError(t, err)
+	assert.False(t, failed > maxFailed)
+}
+
+func TestCountFailedNodesNotProvisioned(t *testing.T) {
+	results := []cluster.NodeResult{
+		{MachineName: "test-lille-0", Phase: cluster.NodePhaseProvisioned},
+		{MachineName: "test-lille-1", Phase: cluster.NodePhaseMachineCreated},
+		{MachineName: "test-nantes-0", Phase: cluster.NodePhaseSkipped},
+	}
+
+	failed, total := countFailedNodes(results)
+	assert.Equal(t, 1, failed)
+	assert.Equal(t, 2, total)
+}
+
+// newCreateClusterContext returns the context of the create-cluster command with the given command line flags
+func newCreateClusterContext(t *testing.T, args ...string) *cli.Context {
+	set := flag.NewFlagSet(CreateClusterCliCommand.Name, flag.ContinueOnError)
+	for _, f := range CreateClusterCliCommand.Flags {
+		f.Apply(set)
+	}
+	assert.NoError(t, set.Parse(args))
+
+	ctx := cli.NewContext(nil, set, nil)
+	ctx.Command = CreateClusterCliCommand
+
+	return ctx
+}
+
+// Test applyClusterSpec
+func TestApplyClusterSpecCommandLineOverride(t *testing.T) {
+	spec, err := parseClusterSpec([]byte("g5k:\n  walltime: \"2:00:00\"\n  image: jessie-x64-min\n  reserve-nodes:\n    lille: 4\n"))
+	assert.NoError(t, err)
+
+	c := CreateClusterCommand{cli: newCreateClusterContext(t, "--g5k-walltime", "4:00:00", "--g5k-reserve-nodes", "nantes:2")}
+	assert.NoError(t, c.applyClusterSpec(spec))
+
+	assert.Equal(t, "4:00:00", c.cli.String("g5k-walltime"))
+	assert.Equal(t, []string{"nantes:2"}, c.cli.StringSlice("g5k-reserve-nodes"))
+	assert.Equal(t, "jessie-x64-min", c.cli.String("g5k-image"))
+}
+
+func TestApplyClusterSpecSwarmTypeOverride(t *testing.T) {
+	spec, err := parseClusterSpec([]byte("swarm:\n  type: mode\n  master: [\"lille-0\"]\n"))
+	assert.NoError(t, err)
+
+	c := CreateClusterCommand{cli: newCreateClusterContext(t, "--swarm-standalone-enable")}
+	assert.NoError(t, c.applyClusterSpec(spec))
+
+	assert.True(t, c.cli.Bool("swarm-standalone-enable"))
+	assert.False(t, c.cli.Bool("swarm-mode-enable"))
+	assert.Equal(t, []string{"lille-0"}, c.cli.StringSlice("swarm-master"))
+}
+
+func TestApplyClusterSpecEnvironmentVariable(t *testing.T) {
+	os.Setenv("G5K_WALLTIME", "6:00:00")
+	defer os.Unsetenv("G5K_WALLTIME")
+
+	spec, err := parseClusterSpec([]byte("g5k:\n  walltime: \"2:00:00\"\n  username: user\n"))
+	assert.NoError(t, err)
+
+	c := CreateClusterCommand{cli: newCreateClusterContext(t)}
+	assert.NoError(t, c.applyClusterSpec(spec))
+
+	assert.Equal(t, "6:00:00", c.cli.String("g5k-walltime"))
+	assert.Equal(t, "user", c.cli.String("g5k-username"))
+}
@@ -0,0 +1,99 @@
+package command
+
+import (
+	"fmt"
+
+	"github.com/codegangsta/cli"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+)
+
+var (
+	// DeployClusterCliCommand represent the CLI command "deploy-cluster" with its flags
+	DeployClusterCliCommand = cli.Command{
+		Name:      "deploy-cluster",
+		Aliases:   []string{"deploy", "d"},
+		Usage:     "Deploy and provision a cluster reserved in advance",
+		ArgsUsage: "cluster name",
+		Action:    RunDeployClusterCommand,
+		Flags: append([]cli.Flag{
+			cli.BoolFlag{
+				EnvVar: "G5K_NO_WAIT",
+				Name:   "no-wait",
+				Usage:  "Fail if the jobs are not started instead of waiting for them",
+			},
+		}, clusterBuildFlags...),
+	}
+)
+
+// DeployClusterCommand contain global parameters for the command "deploy-cluster"
+type DeployClusterCommand struct {
+	cli *cli.Context
+}
+
+// checkCliParameters perform checks on CLI parameters
+func (c *DeployClusterCommand) checkCliParameters() error {
+	// check cluster name
+	if c.cli.NArg() != 1 {
+		return fmt.Errorf("You must provide the name of the cluster to deploy")
+	}
+
+	return nil
+}
+
+// checkJobsStarted returns an error if a submitted job of the cluster is not started yet
+func (c *DeployClusterCommand) checkJobsStarted(name string) error {
+	// load cluster state
+	cl, err := cluster.LoadCluster(name)
+	if err != nil {
+		return err
+	}
+	defer cl.Config.LibMachineClient.Close()
+
+	// create Grid5000 API client using the cluster credentials
+	g5kAPI := g5k.Init(cl.Config.G5kUsername, cl.Config.G5kPassword)
+
+	for _, j := range cl.Jobs {
+		if j.Phase != cluster.JobPhaseSubmitted {
+			continue
+		}
+
+		state, err := g5kAPI.GetJobState(j.Site, j.ID)
+		if err != nil {
+			return fmt.Errorf("Unable to get the state of job '%d' on site '%s': %s", j.ID, j.Site, err)
+		}
+
+		if state != "running" {
+			return fmt.Errorf("The job '%d' on site '%s' is not started yet (state: '%s', reservation: '%s')", j.ID, j.Site, state, j.Reservation)
+		}
+	}
+
+	return nil
+}
+
+// RunDeployClusterCommand deploy a cluster reserved in advance
+func RunDeployClusterCommand(cli *cli.Context) error {
+	c := DeployClusterCommand{cli: cli}
+
+	// check CLI parameters
+	if err := c.checkCliParameters(); err != nil {
+		return err
+	}
+
+	// check the jobs are started if waiting is disabled
+	if c.cli.Bool("no-wait") {
+		if err := c.checkJobsStarted(c.cli.Args().First()); err != nil {
+			return err
+		}
+	}
+
+	// check cluster building parameters
+	if err := checkClusterBuildParameters(c.cli); err != nil {
+		return err
+	}
+
+	// the deployment resume the cluster creation after the jobs submission
+	cc := CreateClusterCommand{cli: cli}
+	return cc.resumeCluster(c.cli.Args().First())
+}
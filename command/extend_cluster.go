@@ -0,0 +1,242 @@
+package command
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine/log"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+)
+
+var (
+	// ExtendClusterCliCommand represent the CLI command "extend-cluster" with its flags
+	ExtendClusterCliCommand = cli.Command{
+		Name:      "extend-cluster",
+		Aliases:   []string{"extend", "e"},
+		Usage:     "Change the walltime of all the jobs of a cluster",
+		ArgsUsage: "cluster name",
+		Action:    RunExtendClusterCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				EnvVar: "G5K_EXTEND_WALLTIME",
+				Name:   "walltime",
+				Usage:  "New walltime (hh:mm:ss) or walltime change (+hh:mm:ss, -hh:mm:ss)",
+				Value:  "",
+			},
+		},
+	}
+)
+
+// ExtendClusterCommand contain global parameters for the command "extend-cluster"
+type ExtendClusterCommand struct {
+	cli *cli.Context
+}
+
+// checkCliParameters perform checks on CLI parameters
+func (c *ExtendClusterCommand) checkCliParameters() error {
+	// check cluster name
+	if c.cli.NArg() != 1 {
+		return fmt.Errorf("You must provide the name of the cluster to extend")
+	}
+
+	// check walltime
+	if c.cli.String("walltime") == "" {
+		return fmt.Errorf("You must provide a walltime")
+	}
+
+	if _, err := computeNewWalltime("1:00:00", c.cli.String("walltime")); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// computeNewWalltime returns the walltime after applying the given change (absolute or relative) to the current walltime
+func computeNewWalltime(current string, change string) (string, error) {
+	// absolute walltime
+	if !strings.HasPrefix(change, "+") && !strings.HasPrefix(change, "-") {
+		d, err := ParseWalltime(change)
+		if err != nil {
+			return "", err
+		}
+
+		return FormatWalltime(d), nil
+	}
+
+	// relative walltime
+	currentDuration, err := ParseWalltime(current)
+	if err != nil {
+		return "", err
+	}
+
+	delta, err := ParseWalltime(change[1:])
+	if err != nil {
+		return "", err
+	}
+
+	if strings.HasPrefix(change, "-") {
+		delta = -delta
+	}
+
+	if currentDuration+delta <= 0 {
+		return "", fmt.Errorf("The walltime change '%s' can't be applied to the walltime '%s'", change, current)
+	}
+
+	return FormatWalltime(currentDuration + delta), nil
+}
+
+// walltimeChange is the result of a walltime change request for a job
+type walltimeChange struct {
+	Status  string // OAR answer
+	Granted string // walltime of the job read after the request (empty if unknown)
+	Pending bool   // the granted walltime is not the requested one yet
+}
+
+// changeJobWalltime request a walltime change for a job of the cluster, then read the walltime granted by OAR and store it in the configuration of the machines of the job
+// The machines configuration is not updated if the granted walltime can't be read
+func changeJobWalltime(g5kAPI *g5k.G5K, cl *cluster.Cluster, j *cluster.Job, change string) (*walltimeChange, error) {
+	// get the walltime before the change
+	before, err := g5kAPI.GetJobStatus(j.Site, j.ID)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to get the walltime of the job: %s", err)
+	}
+
+	expected, err := computeNewWalltime(FormatWalltime(before.Walltime), change)
+	if err != nil {
+		return nil, err
+	}
+
+	status, err := g5kAPI.ChangeJobWalltime(j.Site, j.ID, change)
+	if err != nil {
+		return nil, err
+	}
+
+	// read the walltime granted by OAR (the change may be applied later)
+	after, err := g5kAPI.GetJobStatus(j.Site, j.ID)
+	if err != nil {
+		log.Warnf("Unable to get the walltime of job '%d' on site '%s' after the change: %s", j.ID, j.Site, err)
+		return &walltimeChange{Status: status, Pending: true}, nil
+	}
+
+	result := &walltimeChange{Status: status, Granted: FormatWalltime(after.Walltime), Pending: FormatWalltime(after.Walltime) != expected}
+	if after.Walltime != before.Walltime {
+		updateMachinesWalltime(cl, j.ID, result.Granted)
+	}
+
+	return result, nil
+}
+
+// updateMachinesWalltime set the walltime in the configuration of the machines of the given job
+func updateMachinesWalltime(cl *cluster.Cluster, jobID int, walltime string) {
+	for _, n := range cl.Nodes {
+		if n.G5kJobID != jobID {
+			continue
+		}
+
+		if exists, err := cl.Config.LibMachineClient.Exists(n.MachineName); err != nil || !exists {
+			continue
+		}
+
+		if err := UpdateG5kDriverConfig(cl.Config.LibMachineClient.Filestore, n.MachineName, map[string]interface{}{"G5kWalltime": walltime}); err != nil {
+			log.Errorf("Unable to update the walltime of machine '%s': %s", n.MachineName, err)
+		}
+	}
+}
+
+// updateClusterWalltime set the walltime of the cluster to the walltime of its jobs if they all have the same, and save the cluster state
+func updateClusterWalltime(g5kAPI *g5k.G5K, cl *cluster.Cluster) error {
+	walltime := ""
+	for _, j := range cl.Jobs {
+		// skip jobs not submitted
+		if j.ID == 0 {
+			continue
+		}
+
+		status, err := g5kAPI.GetJobStatus(j.Site, j.ID)
+		if err != nil || status.IsEnded() {
+			return nil
+		}
+
+		if walltime != "" && FormatWalltime(status.Walltime) != walltime {
+			return nil
+		}
+		walltime = FormatWalltime(status.Walltime)
+	}
+
+	if walltime == "" || walltime == cl.Config.G5kWalltime {
+		return nil
+	}
+
+	cl.Config.G5kWalltime = walltime
+	return cl.Save()
+}
+
+// ExtendCluster request a walltime change for all the jobs of the cluster
+func (c *ExtendClusterCommand) ExtendCluster() error {
+	// load cluster state
+	cl, err := cluster.LoadCluster(c.cli.Args().First())
+	if err != nil {
+		return err
+	}
+	defer cl.Config.LibMachineClient.Close()
+
+	// create Grid5000 API client using the cluster credentials
+	g5kAPI := g5k.Init(cl.Config.G5kUsername, cl.Config.G5kPassword)
+
+	// output writer with automatic tab handling
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "SITE\tJOB ID\tRESULT\tWALLTIME\n")
+
+	// request the walltime change for each job
+	failures := 0
+	for _, j := range cl.Jobs {
+		// skip jobs not submitted
+		if j.ID == 0 {
+			continue
+		}
+
+		change, err := changeJobWalltime(g5kAPI, cl, j, c.cli.String("walltime"))
+		if err != nil {
+			fmt.Fprintf(w, "%s\t%d\trefused: %s\t-\n", j.Site, j.ID, err)
+			failures++
+			continue
+		}
+
+		result := "accepted"
+		if change.Pending {
+			result = "pending"
+		}
+
+		fmt.Fprintf(w, "%s\t%d\t%s: %s\t%s\n", j.Site, j.ID, result, change.Status, valueOrDash(change.Granted))
+	}
+
+	w.Flush()
+
+	// update the cluster walltime with the walltime granted to its jobs
+	if err := updateClusterWalltime(g5kAPI, cl); err != nil {
+		return err
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("The walltime change was refused for %d job(s)", failures)
+	}
+
+	return nil
+}
+
+// RunExtendClusterCommand change the walltime of a cluster
+func RunExtendClusterCommand(cli *cli.Context) error {
+	c := ExtendClusterCommand{cli: cli}
+
+	// check CLI parameters
+	if err := c.checkCliParameters(); err != nil {
+		return err
+	}
+
+	return c.ExtendCluster()
+}
@@ -0,0 +1,31 @@
+package command
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeNewWalltimeAbsolute(t *testing.T) {
+	w, err := computeNewWalltime("1:00:00", "4:30:00")
+	assert.NoError(t, err)
+	assert.Equal(t, "4:30:00", w)
+}
+
+func TestComputeNewWalltimeRelative(t *testing.T) {
+	w, err := computeNewWalltime("1:00:00", "+2:00:00")
+	assert.NoError(t, err)
+	assert.Equal(t, "3:00:00", w)
+
+	w, err = computeNewWalltime("3:00:00", "-0:30:00")
+	assert.NoError(t, err)
+	assert.Equal(t, "2:30:00", w)
+}
+
+func TestComputeNewWalltimeIncorrect(t *testing.T) {
+	_, err := computeNewWalltime("1:00:00", "+two hours")
+	assert.Error(t, err)
+
+	_, err = computeNewWalltime("1:00:00", "-2:00:00")
+	assert.Error(t, err)
+}
@@ -0,0 +1,124 @@
+package command
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+var (
+	// eventsFlags are the flags of the commands writing the lifecycle events
+	eventsFlags = []cli.Flag{
+		cli.StringFlag{
+			EnvVar: "G5K_EVENTS",
+			Name:   "events",
+			Usage:  "Write the lifecycle events in the given format ('json' lines) to the standard output or to the events file",
+			Value:  "",
+		},
+
+		cli.StringFlag{
+			EnvVar: "G5K_EVENTS_FILE",
+			Name:   "events-file",
+			Usage:  "Append the lifecycle events to the given file instead of the standard output",
+			Value:  "",
+		},
+	}
+
+	// clusterBuildFlags are the flags of the commands reserving, deploying and provisionning nodes ("create-cluster", "deploy-cluster" and "scale-cluster")
+	clusterBuildFlags = append([]cli.Flag{
+		cli.BoolFlag{
+			EnvVar: "G5K_ROLLBACK_ON_FAILURE",
+			Name:   "rollback-on-failure",
+			Usage:  "Kill the jobs and remove the machines created by this command if it fails",
+		},
+
+		cli.StringFlag{
+			EnvVar: "G5K_SITE_FAILURE_POLICY",
+			Name:   "site-failure-policy",
+			Usage:  "Behavior when the reservation or deployment fails on a site : 'abort' the command or 'continue' without the site",
+			Value:  "abort",
+		},
+
+		cli.StringFlag{
+			EnvVar: "G5K_PROGRESS",
+			Name:   "progress",
+			Usage:  "Progress display : 'auto' (live table on a terminal, plain events otherwise), 'table', 'plain' or 'none'",
+			Value:  "auto",
+		},
+
+		cli.IntFlag{
+			EnvVar: "G5K_PROVISION_PARALLELISM",
+			Name:   "provision-parallelism",
+			Usage:  "Maximum number of nodes provisionned at the same time (0 for unlimited)",
+			Value:  0,
+		},
+
+		cli.IntFlag{
+			EnvVar: "G5K_PROVISION_SITE_PARALLELISM",
+			Name:   "provision-site-parallelism",
+			Usage:  "Maximum number of nodes provisionned at the same time on each site (0 for unlimited)",
+			Value:  0,
+		},
+
+		cli.IntFlag{
+			EnvVar: "G5K_PROVISION_ATTEMPTS",
+			Name:   "provision-attempts",
+			Usage:  "Number of attempts of each node provisionning phase",
+			Value:  3,
+		},
+
+		cli.DurationFlag{
+			EnvVar: "G5K_PROVISION_RETRY_DELAY",
+			Name:   "provision-retry-delay",
+			Usage:  "Delay before retrying a node provisionning phase (doubled after each failure)",
+			Value:  10 * time.Second,
+		},
+
+		cli.StringFlag{
+			EnvVar: "G5K_MAX_FAILED_NODES",
+			Name:   "max-failed-nodes",
+			Usage:  "Maximum number (ex: 2) or percentage (ex: 10%) of nodes failing to provision before the command fails",
+			Value:  "0",
+		},
+	}, eventsFlags...)
+)
+
+// checkClusterBuildParameters perform checks on the flags shared by the commands building a cluster (clusterBuildFlags)
+func checkClusterBuildParameters(c *cli.Context) error {
+	// check sites failure policy
+	if p := c.String("site-failure-policy"); p != "abort" && p != "continue" {
+		return fmt.Errorf("Unknown sites failure policy: '%s' (supported: 'abort', 'continue')", p)
+	}
+
+	// check maximum number of failed nodes
+	if _, err := parseMaxFailedNodes(c.String("max-failed-nodes"), 0); err != nil {
+		return err
+	}
+
+	// check provisionning retry parameters
+	if c.Int("provision-attempts") < 1 {
+		return fmt.Errorf("You must provide a positive number of provisionning attempts")
+	}
+
+	if c.Duration("provision-retry-delay") < 0 {
+		return fmt.Errorf("You must provide a positive provisionning retry delay")
+	}
+
+	// check progress display mode
+	if err := checkProgressMode(c.String("progress")); err != nil {
+		return err
+	}
+
+	// check events stream parameters
+	if err := checkEventsParameters(c.String("events"), c.String("events-file")); err != nil {
+		return err
+	}
+
+	// check provisionning parallelism parameters
+	if c.Int("provision-parallelism") < 0 || c.Int("provision-site-parallelism") < 0 {
+		return fmt.Errorf("You must provide a positive provisionning parallelism (0 for unlimited)")
+	}
+
+	return nil
+}
@@ -0,0 +1,358 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Songmu/prompter"
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/docker/machine/libmachine/persist"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+)
+
+var (
+	// GCCliCommand represent the CLI command "gc" with its flags
+	GCCliCommand = cli.Command{
+		Name:   "gc",
+		Usage:  "Remove the machines whose job is ended, and kill the jobs submitted by docker-g5k not used by any machine",
+		Action: RunGCCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				EnvVar: "G5K_USERNAME",
+				Name:   "g5k-username",
+				Usage:  "Your Grid5000 account username (the username of the machines or clusters by default)",
+				Value:  "",
+			},
+
+			cli.StringFlag{
+				EnvVar: "G5K_PASSWORD",
+				Name:   "g5k-password",
+				Usage:  "Your Grid5000 account password (the password of the machines or clusters by default)",
+				Value:  "",
+			},
+
+			cli.StringSliceFlag{
+				EnvVar: "G5K_GC_SITE",
+				Name:   "site",
+				Usage:  "Sites to check for orphaned jobs (the sites of the machines and clusters by default)",
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_GC_DRY_RUN",
+				Name:   "dry-run",
+				Usage:  "Only print the orphaned machines and jobs",
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_GC_NO_CONFIRM",
+				Name:   "no-confirm",
+				Usage:  "Disable confirmation before removing machines and killing jobs",
+			},
+		},
+	}
+)
+
+// GCCommand contain global parameters for the command "gc"
+type GCCommand struct {
+	cli *cli.Context
+}
+
+// gcOrphan is a machine whose job is ended, or a job not used by any machine or cluster
+type gcOrphan struct {
+	Kind  string // 'machine' or 'job'
+	Name  string
+	Site  string
+	JobID int
+	Keep  bool // the job was not submitted by docker-g5k
+}
+
+// Action returns the action to perform on the orphan
+func (o *gcOrphan) Action() string {
+	switch {
+	case o.Keep:
+		return "keep (not submitted by docker-g5k)"
+	case o.Kind == "job":
+		return "kill"
+	default:
+		return "remove"
+	}
+}
+
+// checkCliParameters perform checks on CLI parameters
+func (c *GCCommand) checkCliParameters() error {
+	// check sites
+	for _, site := range c.cli.StringSlice("site") {
+		if site == "" {
+			return fmt.Errorf("The site name can't be empty")
+		}
+	}
+
+	// the given username replaces the one of the machines, the password must be given too (checked again once the machines are loaded)
+	if (c.cli.String("g5k-username") == "") != (c.cli.String("g5k-password") == "") {
+		return fmt.Errorf("You must provide both your Grid5000 account username and password")
+	}
+
+	return nil
+}
+
+// findOrphans returns the machines whose job is ended, and the alive jobs not referenced by any machine or cluster, for the sites whose jobs are known
+// A machine is orphaned only if its job is confirmed ended (the machines whose job state is unknown are kept)
+func findOrphans(machines []removalMachine, endedJobs map[int]bool, referencedJobs map[int]bool, aliveJobs map[string][]g5k.UserJob) []gcOrphan {
+	orphans := []gcOrphan{}
+
+	// machines whose job is ended
+	for _, m := range machines {
+		if endedJobs[m.JobID] {
+			orphans = append(orphans, gcOrphan{Kind: "machine", Name: m.Name, Site: m.Site, JobID: m.JobID})
+		}
+	}
+
+	// alive jobs not referenced by any machine or cluster
+	sites := make([]string, 0, len(aliveJobs))
+	for site := range aliveJobs {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+
+	for _, site := range sites {
+		for _, j := range aliveJobs[site] {
+			if !referencedJobs[j.ID] {
+				orphans = append(orphans, gcOrphan{Kind: "job", Name: strconv.Itoa(j.ID), Site: site, JobID: j.ID, Keep: !j.IsDockerG5kJob()})
+			}
+		}
+	}
+
+	return orphans
+}
+
+// printOrphans print the orphaned machines and jobs with the action to perform
+func printOrphans(out io.Writer, orphans []gcOrphan) {
+	// output writer with automatic tab handling
+	w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "TYPE\tNAME\tSITE\tJOB ID\tACTION\n")
+
+	for _, o := range orphans {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", o.Kind, o.Name, o.Site, o.JobID, o.Action())
+	}
+
+	w.Flush()
+}
+
+// GC remove the machines whose job is ended and kill the jobs submitted by docker-g5k not used by any machine or cluster
+func (c *GCCommand) GC() error {
+	// create a new libmachine client
+	client := libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
+	defer client.Close()
+
+	credentials := g5kCredentials{username: c.cli.String("g5k-username"), password: c.cli.String("g5k-password")}
+
+	// store the referenced jobs and their sites
+	referencedJobs := make(map[int]bool)
+	sites := make(map[string]bool)
+
+	// jobs of the clusters (a cluster being created or resumed may not have machines yet)
+	clusterNames, err := cluster.ListClusters()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range clusterNames {
+		cl, err := cluster.LoadCluster(name)
+		if err != nil {
+			log.Warnf("Unable to load the state of cluster '%s': %s", name, err)
+			continue
+		}
+		cl.Config.LibMachineClient.Close()
+
+		for _, j := range cl.Jobs {
+			referencedJobs[j.ID] = true
+			sites[j.Site] = true
+		}
+
+		if credentials.username == "" {
+			credentials = g5kCredentials{username: cl.Config.G5kUsername, password: cl.Config.G5kPassword}
+		}
+	}
+
+	// load hosts from libmachine storage
+	lst, _, err := persist.LoadAllHosts(client)
+	if err != nil {
+		return err
+	}
+
+	// jobs of the g5k machines of the user
+	machines := []removalMachine{}
+	for _, h := range lst {
+		if h.DriverName != "g5k" {
+			continue
+		}
+
+		driverConfig, err := GetG5kDriverConfig(h.RawDriver)
+		if err != nil {
+			log.Warnf("Skipping machine '%s': %s", h.Name, err)
+			continue
+		}
+
+		if credentials.username == "" {
+			credentials = g5kCredentials{username: driverConfig.G5kUsername, password: driverConfig.G5kPassword}
+		}
+
+		referencedJobs[driverConfig.G5kJobID] = true
+
+		// the jobs of other users are not listed
+		if driverConfig.G5kUsername != credentials.username {
+			log.Warnf("Skipping machine '%s' of user '%s'", h.Name, driverConfig.G5kUsername)
+			continue
+		}
+
+		machines = append(machines, removalMachine{Name: h.Name, Site: driverConfig.G5kSite, JobID: driverConfig.G5kJobID, credentials: credentials})
+		sites[driverConfig.G5kSite] = true
+	}
+
+	// check username and password
+	if credentials.username == "" || credentials.password == "" {
+		return fmt.Errorf("You must provide your Grid5000 account username and password")
+	}
+
+	// the given sites replace the sites of the machines and clusters
+	if len(c.cli.StringSlice("site")) > 0 {
+		sites = make(map[string]bool)
+		for _, site := range c.cli.StringSlice("site") {
+			sites[site] = true
+		}
+	}
+
+	// get the alive jobs of the user on each site (the site is not checked on error)
+	g5kAPI := g5k.Init(credentials.username, credentials.password)
+	aliveJobs := make(map[string][]g5k.UserJob)
+	for site := range sites {
+		jobs, err := g5kAPI.GetUserJobs(site)
+		if err != nil {
+			log.Warnf("Unable to get the jobs of site '%s', it will not be checked: %s", site, err)
+			continue
+		}
+
+		aliveJobs[site] = jobs
+	}
+
+	// get the state of the jobs of the machines on the checked sites (the machines are kept if the state is unknown)
+	endedJobs := make(map[int]bool)
+	checkedJobs := make(map[int]bool)
+	for _, m := range machines {
+		if !sites[m.Site] || checkedJobs[m.JobID] {
+			continue
+		}
+		checkedJobs[m.JobID] = true
+
+		status, err := g5kAPI.GetJobStatus(m.Site, m.JobID)
+		if err != nil {
+			log.Warnf("Unable to get the state of job '%d' on site '%s', its machines will not be checked: %s", m.JobID, m.Site, err)
+			continue
+		}
+
+		endedJobs[m.JobID] = status.IsEnded()
+	}
+
+	orphans := findOrphans(machines, endedJobs, referencedJobs, aliveJobs)
+
+	// build the removal plan of the orphans
+	plan := &removalPlan{Machines: []removalMachine{}, Jobs: make(map[int]string), Clusters: []string{}, credentials: make(map[int]g5kCredentials)}
+	deadJobs := make(map[int]bool)
+	for _, o := range orphans {
+		switch {
+		case o.Keep:
+		case o.Kind == "job":
+			plan.Jobs[o.JobID] = o.Site
+			plan.credentials[o.JobID] = credentials
+		default:
+			plan.Machines = append(plan.Machines, removalMachine{Name: o.Name, Site: o.Site, JobID: o.JobID})
+			deadJobs[o.JobID] = true
+		}
+	}
+
+	if len(orphans) == 0 {
+		log.Info("No orphaned machine or job found")
+		return nil
+	}
+
+	printOrphans(os.Stdout, orphans)
+
+	// only print the orphans in dry run mode, or if there is nothing to do
+	if c.cli.Bool("dry-run") || (len(plan.Machines) == 0 && len(plan.Jobs) == 0) {
+		return nil
+	}
+
+	// if confirmation is enabled (default behavior)
+	if !c.cli.Bool("no-confirm") {
+		log.Warn("WARNING: The jobs will be killed and the node(s) will be unavailable !")
+
+		// ask for confirmation
+		if !prompter.YN("Are you sure?", false) {
+			return fmt.Errorf("The operation was canceled by the user")
+		}
+	}
+
+	// kill the orphaned jobs
+	jobIDs := make([]int, 0, len(plan.Jobs))
+	for id := range plan.Jobs {
+		jobIDs = append(jobIDs, id)
+	}
+	sort.Ints(jobIDs)
+
+	results := []removalResult{}
+	for _, id := range jobIDs {
+		r := killJob(id, plan.Jobs[id], plan.credentials[id])
+		if r.Err != nil {
+			log.Errorf("Unable to kill job '%d' on site '%s': %s", id, r.Site, r.Err)
+		}
+
+		results = append(results, r)
+	}
+
+	// remove the dead machines from libmachine storage
+	for _, m := range plan.Machines {
+		if err := client.Remove(m.Name); err != nil {
+			log.Errorf("Error while removing '%s' machine: %s", m.Name, err)
+			results = append(results, removalResult{Kind: "machine", Name: m.Name, Site: m.Site, Status: "failed", Err: err})
+			continue
+		}
+
+		results = append(results, removalResult{Kind: "machine", Name: m.Name, Site: m.Site, Status: "removed"})
+	}
+
+	// remove the dead jobs from the clusters state
+	if err := (&RemoveClusterCommand{cli: c.cli}).updateClustersState(map[string]bool{}, deadJobs); err != nil {
+		results = append(results, removalResult{Kind: "cluster", Name: "-", Status: "failed", Err: err})
+	}
+
+	printRemovalReport(os.Stdout, results)
+
+	for _, r := range results {
+		if r.Err != nil {
+			return fmt.Errorf("Some orphaned machines or jobs could not be removed, see the removal report")
+		}
+	}
+
+	return nil
+}
+
+// RunGCCommand remove the orphaned machines and jobs
+func RunGCCommand(cli *cli.Context) error {
+	c := GCCommand{cli: cli}
+
+	// check CLI parameters
+	if err := c.checkCliParameters(); err != nil {
+		return err
+	}
+
+	return c.GC()
+}
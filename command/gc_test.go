@@ -0,0 +1,49 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+)
+
+func TestFindOrphans(t *testing.T) {
+	machines := []removalMachine{
+		{Name: "exp-nantes-0", Site: "nantes", JobID: 111111},
+		{Name: "old-nantes-0", Site: "nantes", JobID: 222222},
+		{Name: "exp-lille-0", Site: "lille", JobID: 333333},
+	}
+	referenced := map[int]bool{111111: true, 222222: true, 333333: true, 444444: true}
+	alive := map[string][]g5k.UserJob{
+		"nantes": {
+			{ID: 111111, State: "running", Name: g5k.JobName},
+			{ID: 444444, State: "waiting", Name: g5k.JobName},
+			{ID: 555555, State: "running", Name: g5k.JobName},
+			{ID: 666666, State: "running", Name: "my-experiment"},
+		},
+	}
+
+	// the state of job 333333 is unknown, its machine is kept
+	ended := map[int]bool{111111: false, 222222: true}
+
+	orphans := findOrphans(machines, ended, referenced, alive)
+	assert.Equal(t, []gcOrphan{
+		{Kind: "machine", Name: "old-nantes-0", Site: "nantes", JobID: 222222},
+		{Kind: "job", Name: "555555", Site: "nantes", JobID: 555555},
+		{Kind: "job", Name: "666666", Site: "nantes", JobID: 666666, Keep: true},
+	}, orphans)
+}
+
+func TestPrintOrphans(t *testing.T) {
+	var buf bytes.Buffer
+	printOrphans(&buf, []gcOrphan{
+		{Kind: "machine", Name: "old-nantes-0", Site: "nantes", JobID: 222222},
+		{Kind: "job", Name: "555555", Site: "nantes", JobID: 555555},
+		{Kind: "job", Name: "666666", Site: "nantes", JobID: 666666, Keep: true},
+	})
+	assert.Contains(t, buf.String(), "remove")
+	assert.Contains(t, buf.String(), "kill")
+	assert.Contains(t, buf.String(), "keep (not submitted by docker-g5k)")
+}
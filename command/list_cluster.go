@@ -1,25 +1,57 @@
 package command
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
-	"text/tabwriter"
-
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
 
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/persist"
+	"gopkg.in/yaml.v2"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
 )
 
 var (
 	// ListClusterCliCommand represent the CLI command "list-cluster" with its flags
 	ListClusterCliCommand = cli.Command{
-		Name:    "list-cluster",
-		Aliases: []string{"ls-cluster", "ls", "l"},
-		Usage:   "List all clusters and their number of nodes",
-		Action:  RunListClusterCommand,
+		Name:      "list-cluster",
+		Aliases:   []string{"ls-cluster", "ls", "l"},
+		Usage:     "List all clusters and their number of nodes",
+		ArgsUsage: "[cluster name...]",
+		Action:    RunListClusterCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				EnvVar: "G5K_LS_FORMAT",
+				Name:   "format",
+				Usage:  "Output format : 'table', 'json', 'yaml' or a Go template (ex: '{{.Name}} {{len .Nodes}}')",
+				Value:  "table",
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_LS_QUIET",
+				Name:   "quiet, q",
+				Usage:  "Only print the cluster names (and the job IDs of the machines not belonging to a named cluster)",
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_LS_PRUNE",
+				Name:   "prune",
+				Usage:  "Remove the local machines (and clusters state) of the jobs terminated or in error",
+			},
+		},
 	}
 )
 
@@ -28,55 +60,474 @@ type ListClusterCommand struct {
 	cli *cli.Context
 }
 
-// ListCluster list all clusters
-func (c *ListClusterCommand) ListCluster() error {
+// nodeInfo contains the listed informations of a node
+type nodeInfo struct {
+	Machine  string `json:"machine" yaml:"machine"`
+	Site     string `json:"site" yaml:"site"`
+	JobID    int    `json:"job_id" yaml:"job_id"`
+	Hostname string `json:"hostname" yaml:"hostname"`
+	IP       string `json:"ip" yaml:"ip"`
+}
+
+// jobInfo contains the listed informations of a job, its state is 'unknown' if it cannot be retrieved from the API
+type jobInfo struct {
+	ID        int    `json:"id" yaml:"id"`
+	Site      string `json:"site" yaml:"site"`
+	State     string `json:"state" yaml:"state"`
+	StartedAt string `json:"started_at" yaml:"started_at"`
+	Remaining string `json:"remaining" yaml:"remaining"`
+}
+
+// clusterInfo contains the listed informations of a cluster (or of a job not belonging to a named cluster, named "-")
+type clusterInfo struct {
+	Name      string     `json:"name" yaml:"name"`
+	Sites     []string   `json:"sites" yaml:"sites"`
+	JobIDs    []int      `json:"job_ids" yaml:"job_ids"`
+	Walltime  string     `json:"walltime" yaml:"walltime"`
+	Image     string     `json:"image" yaml:"image"`
+	SwarmType string     `json:"swarm_type" yaml:"swarm_type"`
+	Masters   []string   `json:"masters" yaml:"masters"`
+	Jobs      []jobInfo  `json:"jobs" yaml:"jobs"`
+	Nodes     []nodeInfo `json:"nodes" yaml:"nodes"`
+
+	// API client used to get the jobs state (credentials of the cluster or of its first machine)
+	g5kAPI *g5k.G5K
+}
+
+// checkCliParameters perform checks on CLI parameters
+func (c *ListClusterCommand) checkCliParameters() error {
+	// check output format
+	switch f := c.cli.String("format"); {
+	case f == "table", f == "json", f == "yaml":
+	case strings.Contains(f, "{{"):
+		if _, err := template.New("format").Parse(f); err != nil {
+			return fmt.Errorf("Syntax error in format template: '%s'", err)
+		}
+	default:
+		return fmt.Errorf("Unknown output format: '%s' (supported: 'table', 'json', 'yaml' or a Go template)", f)
+	}
+
+	return nil
+}
+
+// newClusterInfo returns the informations of a named cluster from its state
+func newClusterInfo(cl *cluster.Cluster) *clusterInfo {
+	info := &clusterInfo{
+		Name:      cl.Name,
+		Sites:     []string{},
+		JobIDs:    []int{},
+		Walltime:  cl.Config.G5kWalltime,
+		Image:     cl.Config.G5kImage,
+		SwarmType: "none",
+		Masters:   []string{},
+		Jobs:      []jobInfo{},
+		Nodes:     []nodeInfo{},
+		g5kAPI:    g5k.Init(cl.Config.G5kUsername, cl.Config.G5kPassword),
+	}
+
+	// jobs and their sites
+	for _, j := range cl.Jobs {
+		info.JobIDs = append(info.JobIDs, j.ID)
+		info.Jobs = append(info.Jobs, jobInfo{ID: j.ID, Site: j.Site, State: "unknown"})
+		info.Sites = appendMissing(info.Sites, j.Site)
+	}
+
+	// Swarm configuration
+	if cl.Config.SwarmModeGlobalConfig != nil {
+		info.SwarmType = "mode"
+	}
+	if cl.Config.SwarmStandaloneGlobalConfig != nil {
+		info.SwarmType = "standalone"
+	}
+	info.Masters = append(info.Masters, cl.Config.SwarmMasterNode...)
+
+	return info
+}
+
+// appendMissing append the value to the slice if it is not already in it
+func appendMissing(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+
+	return append(values, value)
+}
+
+// collectClusters returns the informations of the clusters to list, sorted by name (the jobs not belonging to a named cluster are sorted by ID)
+func (c *ListClusterCommand) collectClusters() ([]*clusterInfo, error) {
 	// create a new libmachine client
 	client := libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
 	defer client.Close()
 
+	// get the clusters to list (all clusters by default)
+	clusterNames := c.cli.Args()
+	if len(clusterNames) == 0 {
+		names, err := cluster.ListClusters()
+		if err != nil {
+			return nil, err
+		}
+
+		clusterNames = names
+	}
+
+	// store clusters to list, the cluster of each job, and the IP address of the machines
+	infos := make(map[string]*clusterInfo)
+	jobsCluster := make(map[int]string)
+	machinesIP := make(map[string]string)
+
+	for _, name := range clusterNames {
+		// load cluster state
+		cl, err := cluster.LoadCluster(name)
+		if err != nil {
+			// only clusters explicitly requested are mandatory
+			if c.cli.NArg() > 0 {
+				return nil, err
+			}
+
+			log.Warnf("Skipping cluster '%s': %s", name, err)
+			continue
+		}
+		cl.Config.LibMachineClient.Close()
+
+		infos[name] = newClusterInfo(cl)
+		for _, j := range cl.Jobs {
+			jobsCluster[j.ID] = name
+		}
+
+		for k, ip := range cl.Config.HostsLookupTable {
+			machinesIP[k] = ip
+		}
+	}
+
 	// load hosts from libmachine storage
 	lst, _, err := persist.LoadAllHosts(client)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// store machines count per jobs
-	machinesPerJobs := make(map[int][]string)
-
-	// count machines per Job
+	// add machines to their cluster
 	for _, machine := range lst {
 		// only catch Grid'5000 nodes
-		if machine.DriverName == "g5k" {
-			// get machine driver configuration
-			driverConfig, err := GetG5kDriverConfig(machine.RawDriver)
-			if err != nil {
+		if machine.DriverName != "g5k" {
+			continue
+		}
+
+		// get machine driver configuration
+		driverConfig, err := GetG5kDriverConfig(machine.RawDriver)
+		if err != nil {
+			continue
+		}
+
+		node := nodeInfo{
+			Machine:  machine.Name,
+			Site:     driverConfig.G5kSite,
+			JobID:    driverConfig.G5kJobID,
+			Hostname: driverConfig.G5kHostToProvision,
+			IP:       machinesIP[machine.Name],
+		}
+
+		if node.IP == "" && driverConfig.BaseDriver != nil {
+			node.IP = driverConfig.IPAddress
+		}
+
+		// machines of a named cluster
+		if name, ok := jobsCluster[driverConfig.G5kJobID]; ok {
+			infos[name].Nodes = append(infos[name].Nodes, node)
+			continue
+		}
+
+		// machines not belonging to a named cluster are listed by job (only when listing all clusters)
+		if c.cli.NArg() == 0 {
+			key := strconv.Itoa(driverConfig.G5kJobID)
+			if _, ok := infos[key]; !ok {
+				infos[key] = &clusterInfo{
+					Name:      "-",
+					Sites:     []string{driverConfig.G5kSite},
+					JobIDs:    []int{driverConfig.G5kJobID},
+					Walltime:  driverConfig.G5kWalltime,
+					Image:     driverConfig.G5kImage,
+					SwarmType: "none",
+					Masters:   []string{},
+					Jobs:      []jobInfo{{ID: driverConfig.G5kJobID, Site: driverConfig.G5kSite, State: "unknown"}},
+					g5kAPI:    g5k.Init(driverConfig.G5kUsername, driverConfig.G5kPassword),
+				}
+			}
+
+			infos[key].Nodes = append(infos[key].Nodes, node)
+		}
+	}
+
+	// sort clusters and nodes for a stable output
+	keys := make([]string, 0, len(infos))
+	for k := range infos {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	clusters := []*clusterInfo{}
+	for _, k := range keys {
+		nodes := infos[k].Nodes
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].Machine < nodes[j].Machine })
+		clusters = append(clusters, infos[k])
+	}
+
+	return clusters, nil
+}
+
+// newJobInfo returns the informations of a job from its status at the given date
+func newJobInfo(id int, site string, status *g5k.JobStatus, now time.Time) jobInfo {
+	job := jobInfo{ID: id, Site: site, State: status.State}
+
+	if !status.StartedAt.IsZero() {
+		job.StartedAt = status.StartedAt.Format(g5k.ReservationDateFormat)
+		job.Remaining = FormatWalltime(status.Remaining(now))
+	}
+
+	return job
+}
+
+// fetchJobsStatus get the state of the jobs from the API of their site, in parallel (the state stays 'unknown' on error)
+func fetchJobsStatus(clusters []*clusterInfo) {
+	var wg sync.WaitGroup
+	now := time.Now()
+
+	for _, cl := range clusters {
+		for i := range cl.Jobs {
+			wg.Add(1)
+			go func(cl *clusterInfo, job *jobInfo) {
+				defer wg.Done()
+
+				status, err := cl.g5kAPI.GetJobStatus(job.Site, job.ID)
+				if err != nil {
+					log.Warnf("Unable to get the state of job '%d' on site '%s': %s", job.ID, job.Site, err)
+					return
+				}
+
+				*job = newJobInfo(job.ID, job.Site, status, now)
+			}(cl, &cl.Jobs[i])
+		}
+	}
+
+	wg.Wait()
+}
+
+// pruneClusterInfos remove the pruned jobs and their nodes from the clusters informations, and the clusters without jobs left
+func pruneClusterInfos(clusters []*clusterInfo, prunedJobs map[int]bool) []*clusterInfo {
+	remaining := []*clusterInfo{}
+	for _, cl := range clusters {
+		if len(cl.Jobs) == 0 {
+			remaining = append(remaining, cl)
+			continue
+		}
+
+		jobs := []jobInfo{}
+		jobIDs := []int{}
+		sites := []string{}
+		for _, j := range cl.Jobs {
+			if !prunedJobs[j.ID] {
+				jobs = append(jobs, j)
+				jobIDs = append(jobIDs, j.ID)
+				sites = appendMissing(sites, j.Site)
+			}
+		}
+
+		if len(jobs) == 0 {
+			continue
+		}
+
+		nodes := []nodeInfo{}
+		for _, n := range cl.Nodes {
+			if !prunedJobs[n.JobID] {
+				nodes = append(nodes, n)
+			}
+		}
+
+		cl.Jobs, cl.JobIDs, cl.Sites, cl.Nodes = jobs, jobIDs, sites, nodes
+		remaining = append(remaining, cl)
+	}
+
+	return remaining
+}
+
+// pruneClusters remove the local machines of the jobs terminated or in error, and update the clusters state
+// It continues on failures, and returns the clusters to list with an error reporting the failures
+func (c *ListClusterCommand) pruneClusters(clusters []*clusterInfo) ([]*clusterInfo, error) {
+	// get the jobs to prune
+	prunedJobs := make(map[int]bool)
+	for _, cl := range clusters {
+		for _, j := range cl.Jobs {
+			if (&g5k.JobStatus{State: j.State}).IsEnded() {
+				prunedJobs[j.ID] = true
+			}
+		}
+	}
+
+	if len(prunedJobs) == 0 {
+		return clusters, nil
+	}
+
+	// create a new libmachine client
+	client := libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
+	defer client.Close()
+
+	// remove the machines from libmachine storage only (the jobs are already ended), continue on failures
+	failures := 0
+	for _, cl := range clusters {
+		for _, n := range cl.Nodes {
+			if !prunedJobs[n.JobID] {
 				continue
 			}
 
-			// add machine to the list of machines for its job ID
-			machinesPerJobs[driverConfig.G5kJobID] = append(machinesPerJobs[driverConfig.G5kJobID], machine.Name)
+			if err := client.Remove(n.Machine); err != nil {
+				log.Errorf("Error while removing '%s' machine of ended job '%d': '%s'", n.Machine, n.JobID, err)
+				failures++
+				continue
+			}
+
+			log.Infof("Machine '%s' of ended job '%d' pruned", n.Machine, n.JobID)
 		}
 	}
 
-	// output writer with automatic tab handling
-	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	// remove the ended jobs from the clusters state
+	if err := (&RemoveClusterCommand{cli: c.cli}).updateClustersState(map[string]bool{}, prunedJobs); err != nil {
+		return clusters, err
+	}
+
+	clusters = pruneClusterInfos(clusters, prunedJobs)
 
-	// print header
-	fmt.Fprintf(w, "JOB ID\tNUMBER OF MACHINE(S)\tMACHINE(S) NAME\n")
+	if failures > 0 {
+		return clusters, fmt.Errorf("%d failure(s) while pruning the machines of the ended jobs, use 'remove-cluster' to remove them", failures)
+	}
+
+	return clusters, nil
+}
+
+// printClusters print the clusters informations using the given format (table, json, yaml or Go template), or only their identifiers if quiet is set
+func printClusters(out io.Writer, clusters []*clusterInfo, format string, quiet bool) error {
+	// print the cluster names (or job IDs for the jobs not belonging to a named cluster)
+	if quiet {
+		for _, cl := range clusters {
+			if cl.Name == "-" {
+				fmt.Fprintln(out, cl.JobIDs[0])
+				continue
+			}
+
+			fmt.Fprintln(out, cl.Name)
+		}
 
-	// print jobs informations (id, number of machines, machines name)
-	for j, n := range machinesPerJobs {
-		fmt.Fprintf(w, "%d\t%d\t%s\n", j, len(n), strings.Join(n, ", "))
+		return nil
 	}
 
-	// flush output buffer
-	w.Flush()
+	switch format {
+	case "json":
+		b, err := json.MarshalIndent(clusters, "", "  ")
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintln(out, string(b))
+
+	case "yaml":
+		b, err := yaml.Marshal(clusters)
+		if err != nil {
+			return err
+		}
+
+		out.Write(b)
+
+	case "table":
+		// output writer with automatic tab handling
+		w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+
+		// print header
+		fmt.Fprintf(w, "CLUSTER\tJOB ID(S)\tSTATE\tSTARTED AT\tREMAINING\tNUMBER OF MACHINE(S)\tMACHINE(S) NAME\n")
+
+		// print clusters informations (name, jobs id, jobs status, number of machines, machines name)
+		for _, cl := range clusters {
+			jobs := []string{}
+			states := []string{}
+			started := []string{}
+			remaining := []string{}
+			for _, j := range cl.Jobs {
+				jobs = append(jobs, strconv.Itoa(j.ID))
+				states = append(states, j.State)
+				started = append(started, valueOrDash(j.StartedAt))
+				remaining = append(remaining, valueOrDash(j.Remaining))
+			}
+
+			machines := []string{}
+			for _, n := range cl.Nodes {
+				machines = append(machines, n.Machine)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", cl.Name, strings.Join(jobs, ", "), strings.Join(states, ", "), strings.Join(started, ", "), strings.Join(remaining, ", "), len(machines), strings.Join(machines, ", "))
+		}
+
+		// flush output buffer
+		w.Flush()
+
+	default:
+		// Go template executed for each cluster
+		tmpl, err := template.New("format").Parse(format)
+		if err != nil {
+			return err
+		}
+
+		for _, cl := range clusters {
+			if err := tmpl.Execute(out, cl); err != nil {
+				return err
+			}
+			fmt.Fprintln(out)
+		}
+	}
 
 	return nil
 }
 
+// valueOrDash returns the value, or "-" if it is empty
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return value
+}
+
+// ListCluster list all clusters
+func (c *ListClusterCommand) ListCluster() error {
+	clusters, err := c.collectClusters()
+	if err != nil {
+		return err
+	}
+
+	// get the jobs state (not needed to only print the cluster names)
+	if !c.cli.Bool("quiet") || c.cli.Bool("prune") {
+		fetchJobsStatus(clusters)
+	}
+
+	// remove the machines of the ended jobs if requested (the clusters are still listed if some machines can't be removed)
+	var pruneErr error
+	if c.cli.Bool("prune") {
+		clusters, pruneErr = c.pruneClusters(clusters)
+	}
+
+	if err := printClusters(os.Stdout, clusters, c.cli.String("format"), c.cli.Bool("quiet")); err != nil {
+		return err
+	}
+
+	return pruneErr
+}
+
 // RunListClusterCommand list all clusters you reserved
 func RunListClusterCommand(cli *cli.Context) error {
 	c := ListClusterCommand{cli: cli}
+
+	// check CLI parameters
+	if err := c.checkCliParameters(); err != nil {
+		return err
+	}
+
 	return c.ListCluster()
 }
@@ -0,0 +1,99 @@
+package command
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+)
+
+// testClusters returns a named cluster and a job not belonging to a named cluster
+func testClusters() []*clusterInfo {
+	return []*clusterInfo{
+		{
+			Name:      "exp",
+			Sites:     []string{"lille"},
+			JobIDs:    []int{111111},
+			Walltime:  "1:00:00",
+			Image:     "jessie-x64-min",
+			SwarmType: "mode",
+			Masters:   []string{"exp-lille-0"},
+			Jobs:      []jobInfo{{ID: 111111, Site: "lille", State: "running", StartedAt: "2026-10-20 19:00:00", Remaining: "0:42:00"}},
+			Nodes: []nodeInfo{
+				{Machine: "exp-lille-0", Site: "lille", JobID: 111111, Hostname: "chetemi-1.lille.grid5000.fr", IP: "172.16.37.1"},
+				{Machine: "exp-lille-1", Site: "lille", JobID: 111111, Hostname: "chetemi-2.lille.grid5000.fr", IP: "172.16.37.2"},
+			},
+		},
+		{
+			Name:      "-",
+			Sites:     []string{"nantes"},
+			JobIDs:    []int{222222},
+			SwarmType: "none",
+			Jobs:      []jobInfo{{ID: 222222, Site: "nantes", State: "unknown"}},
+			Nodes:     []nodeInfo{{Machine: "test-nantes", Site: "nantes", JobID: 222222}},
+		},
+	}
+}
+
+func TestPrintClustersTable(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, printClusters(&buf, testClusters(), "table", false))
+	assert.Contains(t, buf.String(), "exp-lille-0, exp-lille-1")
+	assert.Contains(t, buf.String(), "222222")
+	assert.Contains(t, buf.String(), "running")
+	assert.Contains(t, buf.String(), "0:42:00")
+}
+
+func TestPrintClustersJSON(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, printClusters(&buf, testClusters(), "json", false))
+	assert.Contains(t, buf.String(), `"hostname": "chetemi-1.lille.grid5000.fr"`)
+	assert.Contains(t, buf.String(), `"swarm_type": "mode"`)
+}
+
+func TestPrintClustersYAML(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, printClusters(&buf, testClusters(), "yaml", false))
+	assert.Contains(t, buf.String(), "ip: 172.16.37.2")
+}
+
+func TestPrintClustersTemplate(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, printClusters(&buf, testClusters(), "{{.Name}} {{len .Nodes}}", false))
+	assert.Equal(t, "exp 2\n- 1\n", buf.String())
+}
+
+func TestPrintClustersQuiet(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, printClusters(&buf, testClusters(), "json", true))
+	assert.Equal(t, "exp\n222222\n", buf.String())
+}
+
+func TestNewJobInfo(t *testing.T) {
+	start := time.Date(2026, time.October, 20, 17, 0, 0, 0, time.UTC)
+	job := newJobInfo(111111, "lille", &g5k.JobStatus{State: "running", StartedAt: start, Walltime: time.Hour}, start.Add(15*time.Minute))
+	assert.Equal(t, "running", job.State)
+	assert.Equal(t, "0:45:00", job.Remaining)
+	assert.NotEmpty(t, job.StartedAt)
+
+	job = newJobInfo(222222, "nantes", &g5k.JobStatus{State: "waiting"}, start)
+	assert.Equal(t, "waiting", job.State)
+	assert.Empty(t, job.StartedAt)
+	assert.Empty(t, job.Remaining)
+}
+
+func TestPruneClusterInfos(t *testing.T) {
+	clusters := testClusters()
+	clusters[0].Jobs = append(clusters[0].Jobs, jobInfo{ID: 333333, Site: "nancy", State: "terminated"})
+	clusters[0].JobIDs = append(clusters[0].JobIDs, 333333)
+	clusters[0].Nodes = append(clusters[0].Nodes, nodeInfo{Machine: "exp-nancy-0", Site: "nancy", JobID: 333333})
+
+	clusters = pruneClusterInfos(clusters, map[int]bool{222222: true, 333333: true})
+	assert.Len(t, clusters, 1)
+	assert.Equal(t, []int{111111}, clusters[0].JobIDs)
+	assert.Equal(t, []string{"lille"}, clusters[0].Sites)
+	assert.Len(t, clusters[0].Nodes, 2)
+}
@@ -0,0 +1,141 @@
+package command
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+	"github.com/mattn/go-isatty"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
+)
+
+// progressRefreshInterval is the refresh interval of the live progress table
+const progressRefreshInterval = time.Second
+
+// progressReporter reports the cluster lifecycle events sent to its emitter
+type progressReporter struct {
+	emitter *events.Emitter
+
+	// stop the progress display (the events are still written to the events stream)
+	stop func()
+
+	// close the events stream
+	close func()
+}
+
+// checkProgressMode returns an error if the progress mode is not supported
+func checkProgressMode(mode string) error {
+	switch mode {
+	case "", "auto", "table", "plain", "none":
+		return nil
+	default:
+		return fmt.Errorf("Unknown progress mode: '%s' (supported: 'auto', 'table', 'plain', 'none')", mode)
+	}
+}
+
+// checkEventsParameters returns an error if the events stream format is not supported
+func checkEventsParameters(format string, file string) error {
+	if format != "" && format != "json" {
+		return fmt.Errorf("Unknown events format: '%s' (supported: 'json')", format)
+	}
+
+	if file != "" && format == "" {
+		return fmt.Errorf("You must provide the events format to write the events to a file")
+	}
+
+	return nil
+}
+
+// checkConfirmationParameters returns an error if the confirmation prompt is enabled while the standard output is reserved to the events stream
+func checkConfirmationParameters(eventsFormat string, eventsFile string, noConfirm bool) error {
+	if eventsFormat != "" && eventsFile == "" && !noConfirm {
+		return fmt.Errorf("You must disable the confirmation with '--no-confirm' to write the events to the standard output")
+	}
+
+	return nil
+}
+
+// openEventsStream subscribe a JSON lines writer to the emitter if the events format is 'json', and returns a function closing the stream
+// The events are written to the given file (appended), or to the standard output if empty (the logs are then written to the error output)
+func openEventsStream(em *events.Emitter, format string, file string) (func(), error) {
+	if format == "" {
+		return func() {}, nil
+	}
+
+	if file == "" {
+		log.SetOutWriter(os.Stderr)
+		em.Subscribe(events.NewJSONReporter(os.Stdout))
+
+		return func() { log.SetOutWriter(os.Stdout) }, nil
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to open the events file: '%s'", err)
+	}
+	em.Subscribe(events.NewJSONReporter(f))
+
+	return func() { f.Close() }, nil
+}
+
+// reportWriter returns the writer of the reports printed for the user, the error output if the standard output is reserved to the events stream
+func reportWriter(eventsFormat string, eventsFile string) io.Writer {
+	if eventsFormat != "" && eventsFile == "" {
+		return os.Stderr
+	}
+
+	return os.Stdout
+}
+
+// startProgressReporter start reporting the progress of a cluster using the given mode, and the events stream if enabled
+// 'auto' displays a live table on a terminal and plain events otherwise, 'none' only keeps the logs
+func startProgressReporter(mode string, clusterName string, eventsFormat string, eventsFile string) (*progressReporter, error) {
+	if err := checkProgressMode(mode); err != nil {
+		return nil, err
+	}
+
+	p := &progressReporter{emitter: events.NewEmitter(clusterName), stop: func() {}, close: func() {}}
+
+	closeEvents, err := openEventsStream(p.emitter, eventsFormat, eventsFile)
+	if err != nil {
+		return nil, err
+	}
+	p.close = closeEvents
+
+	// the standard output is reserved to the events stream
+	if eventsFormat != "" && eventsFile == "" {
+		mode = "none"
+	}
+
+	if mode == "" || mode == "auto" {
+		mode = "plain"
+		if isatty.IsTerminal(os.Stdout.Fd()) {
+			mode = "table"
+		}
+	}
+
+	switch mode {
+	case "plain":
+		p.emitter.Subscribe(events.NewLineReporter(os.Stdout))
+
+	case "table":
+		// the logs are printed above the table (they would be erased by its refresh otherwise)
+		r := events.NewTableReporter(os.Stdout)
+		log.SetOutWriter(r)
+		log.SetErrWriter(r)
+
+		p.emitter.Subscribe(r)
+		r.Start(progressRefreshInterval)
+
+		p.stop = func() {
+			r.Stop()
+			log.SetOutWriter(os.Stdout)
+			log.SetErrWriter(os.Stderr)
+		}
+	}
+
+	return p, nil
+}
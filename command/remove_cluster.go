@@ -5,71 +5,370 @@ import (
 
 	"fmt"
 
+	"io"
+	"path"
+	"sort"
 	"strings"
+	"text/tabwriter"
 
 	"github.com/Songmu/prompter"
 	"github.com/codegangsta/cli"
 	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/persist"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
 )
 
 var (
 	// RemoveClusterCliCommand represent the CLI command "remove-cluster" with its flags
 	RemoveClusterCliCommand = cli.Command{
-		Name:    "remove-cluster",
-		Aliases: []string{"rm-cluster", "rm", "r"},
-		Usage:   "Remove a Docker cluster from the Grid'5000 infrastructure",
-		Action:  RunRemoveClusterCommand,
-		Flags: []cli.Flag{
+		Name:      "remove-cluster",
+		Aliases:   []string{"rm-cluster", "rm", "r"},
+		Usage:     "Remove a Docker cluster from the Grid'5000 infrastructure",
+		ArgsUsage: "cluster name, job ID or machine name pattern...",
+		Action:    RunRemoveClusterCommand,
+		Flags: append([]cli.Flag{
+			cli.StringSliceFlag{
+				EnvVar: "G5K_RM_SITE",
+				Name:   "site",
+				Usage:  "Only remove the machines of the given site(s), or all the machines of these sites if no argument is given (ex: nantes)",
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_RM_DRY_RUN",
+				Name:   "dry-run",
+				Usage:  "Only print the machines and jobs that would be removed",
+			},
+
 			cli.BoolFlag{
 				EnvVar: "G5K_RM_NO_CONFIRM",
 				Name:   "no-confirm",
 				Usage:  "Disable confirmation before removing machines",
 			},
-		},
+		}, eventsFlags...),
 	}
 )
 
 // RemoveClusterCommand contain global parameters for the command "rm-cluster"
 type RemoveClusterCommand struct {
-	cli *cli.Context
+	cli    *cli.Context
+	events *events.Emitter
+}
+
+// g5kCredentials contains the Grid'5000 API credentials used to kill a job
+type g5kCredentials struct {
+	username string
+	password string
+}
+
+// removalMachine is a machine selected for removal
+type removalMachine struct {
+	Name        string
+	Site        string
+	JobID       int
+	credentials g5kCredentials
+}
+
+// removalSelector contains the selection criteria of the machines to remove
+type removalSelector struct {
+	jobs     map[int]bool    // job IDs given as argument or belonging to the given clusters
+	patterns []string        // machine name patterns
+	sites    map[string]bool // restrict the selection to these sites (all sites if empty)
+}
+
+// removalPlan contains the machines and jobs to remove, and the clusters whose state will be removed
+type removalPlan struct {
+	Machines []removalMachine
+	Jobs     map[int]string // site of the jobs to kill
+	Clusters []string
+
+	credentials map[int]g5kCredentials // API credentials of the jobs to kill
+	invalid     []removalMachine       // selected machines with an unreadable driver configuration (no job to kill)
+}
+
+// removalResult is the result of killing a job or removing a machine
+type removalResult struct {
+	Kind   string // 'job', 'machine' or 'cluster'
+	Name   string
+	Site   string
+	Status string
+	Err    error
 }
 
 func (c *RemoveClusterCommand) checkCliParameters() error {
-	// check job ID
-	if c.cli.NArg() < 1 {
-		return fmt.Errorf("You must provide the job ID of the nodes you want to remove")
+	// check cluster name, job ID, machine name pattern or site
+	if c.cli.NArg() < 1 && len(c.cli.StringSlice("site")) == 0 {
+		return fmt.Errorf("You must provide the name of the cluster, the job ID or the machine names of the nodes you want to remove, or their site")
+	}
+
+	// check machine name patterns
+	for _, arg := range c.cli.Args() {
+		if _, err := path.Match(arg, ""); err != nil {
+			return fmt.Errorf("Syntax error in machine name pattern '%s': '%s'", arg, err)
+		}
+	}
+
+	// check events stream parameters
+	if err := checkEventsParameters(c.cli.String("events"), c.cli.String("events-file")); err != nil {
+		return err
+	}
+
+	// check confirmation parameters (nothing is removed with a dry run)
+	if !c.cli.Bool("dry-run") {
+		if err := checkConfirmationParameters(c.cli.String("events"), c.cli.String("events-file"), c.cli.Bool("no-confirm")); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// RemoveCluster remove all nodes
+// matches returns true if the machine is selected by the selector
+func (s *removalSelector) matches(m removalMachine) bool {
+	if len(s.sites) > 0 && !s.sites[m.Site] {
+		return false
+	}
+
+	// only the site is given, all its machines are selected
+	if len(s.jobs) == 0 && len(s.patterns) == 0 {
+		return true
+	}
+
+	return s.jobs[m.JobID] || s.matchesName(m.Name)
+}
+
+// matchesName returns true if the machine name matches one of the patterns of the selector
+func (s *removalSelector) matchesName(name string) bool {
+	for _, p := range s.patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newRemovalPlan returns the machines and jobs to remove, killing a job makes all its machines unavailable so they are all removed
+func newRemovalPlan(machines []removalMachine, selector *removalSelector) *removalPlan {
+	plan := &removalPlan{Machines: []removalMachine{}, Jobs: make(map[int]string), Clusters: []string{}, credentials: make(map[int]g5kCredentials)}
+
+	// jobs of the selected machines
+	for _, m := range machines {
+		if selector.matches(m) {
+			plan.Jobs[m.JobID] = m.Site
+			plan.credentials[m.JobID] = m.credentials
+		}
+	}
+
+	// all machines of these jobs
+	for _, m := range machines {
+		if _, ok := plan.Jobs[m.JobID]; ok {
+			plan.Machines = append(plan.Machines, m)
+		}
+	}
+	sort.Slice(plan.Machines, func(i, j int) bool { return plan.Machines[i].Name < plan.Machines[j].Name })
+
+	return plan
+}
+
+// printRemovalPlan print the jobs to kill with their machines, and the clusters whose state will be removed
+func printRemovalPlan(out io.Writer, plan *removalPlan) {
+	jobIDs := make([]int, 0, len(plan.Jobs))
+	for id := range plan.Jobs {
+		jobIDs = append(jobIDs, id)
+	}
+	sort.Ints(jobIDs)
+
+	// output writer with automatic tab handling
+	w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "JOB ID\tSITE\tMACHINE(S) NAME\n")
+	for _, id := range jobIDs {
+		machines := []string{}
+		for _, m := range plan.Machines {
+			if m.JobID == id {
+				machines = append(machines, m.Name)
+			}
+		}
+
+		fmt.Fprintf(w, "%d\t%s\t%s\n", id, plan.Jobs[id], valueOrDash(strings.Join(machines, ", ")))
+	}
+	w.Flush()
+
+	if len(plan.invalid) > 0 {
+		names := []string{}
+		for _, m := range plan.invalid {
+			names = append(names, m.Name)
+		}
+
+		fmt.Fprintf(out, "Machine(s) with an unreadable configuration (removed without killing a job): %s\n", strings.Join(names, ", "))
+	}
+
+	if len(plan.Clusters) > 0 {
+		fmt.Fprintf(out, "Cluster(s) state to remove: %s\n", strings.Join(plan.Clusters, ", "))
+	}
+}
+
+// planRemoval returns the removal plan of the machines selected by the CLI arguments and sites
+func (c *RemoveClusterCommand) planRemoval(lst []*host.Host) (*removalPlan, error) {
+	selector := &removalSelector{jobs: make(map[int]bool), patterns: []string{}, sites: make(map[string]bool)}
+	for _, site := range c.cli.StringSlice("site") {
+		selector.sites[site] = true
+	}
+
+	clusterNames, err := cluster.ListClusters()
+	if err != nil {
+		return nil, err
+	}
+
+	clusters := make(map[string]bool)
+	for _, name := range clusterNames {
+		clusters[name] = true
+	}
+
+	clustersToRemove := []string{}
+	clustersJobsSite := make(map[int]string)
+	clustersJobsCredentials := make(map[int]g5kCredentials)
+	for _, arg := range c.cli.Args() {
+		// the argument is a job ID
+		if jobID, err := strconv.Atoi(arg); err == nil {
+			selector.jobs[jobID] = true
+			continue
+		}
+
+		// the argument is a cluster name
+		if clusters[arg] {
+			cl, err := cluster.LoadCluster(arg)
+			if err != nil {
+				return nil, fmt.Errorf("Unable to load the state of cluster '%s': %s", arg, err)
+			}
+			cl.Config.LibMachineClient.Close()
+
+			// select the jobs of the cluster (on the given sites only)
+			for _, j := range cl.Jobs {
+				if len(selector.sites) == 0 || selector.sites[j.Site] {
+					selector.jobs[j.ID] = true
+					clustersJobsSite[j.ID] = j.Site
+					clustersJobsCredentials[j.ID] = g5kCredentials{username: cl.Config.G5kUsername, password: cl.Config.G5kPassword}
+				}
+			}
+
+			// the state is removed only when the whole cluster is removed
+			if len(selector.sites) == 0 {
+				clustersToRemove = append(clustersToRemove, arg)
+			}
+			continue
+		}
+
+		// the argument is a machine name pattern
+		selector.patterns = append(selector.patterns, arg)
+	}
+
+	// get the g5k machines from libmachine storage
+	machines := []removalMachine{}
+	invalid := []removalMachine{}
+	for _, h := range lst {
+		if h.DriverName != "g5k" {
+			continue
+		}
+
+		driverConfig, err := GetG5kDriverConfig(h.RawDriver)
+		if err != nil {
+			// the machine can only be selected by its name
+			if selector.matchesName(h.Name) {
+				log.Warnf("Unreadable driver configuration of machine '%s', its job will not be killed: %s", h.Name, err)
+				invalid = append(invalid, removalMachine{Name: h.Name})
+				continue
+			}
+
+			log.Warnf("Skipping machine '%s': %s", h.Name, err)
+			continue
+		}
+
+		machines = append(machines, removalMachine{
+			Name:        h.Name,
+			Site:        driverConfig.G5kSite,
+			JobID:       driverConfig.G5kJobID,
+			credentials: g5kCredentials{username: driverConfig.G5kUsername, password: driverConfig.G5kPassword},
+		})
+	}
+
+	// check each machine name pattern selects at least one machine
+	for _, p := range selector.patterns {
+		found := false
+		for _, m := range machines {
+			if ok, _ := path.Match(p, m.Name); ok {
+				found = true
+				break
+			}
+		}
+		for _, m := range invalid {
+			if ok, _ := path.Match(p, m.Name); ok {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("The given parameter '%s' is neither a cluster name, a valid job ID nor matching a machine name", p)
+		}
+	}
+
+	plan := newRemovalPlan(machines, selector)
+	plan.Clusters = clustersToRemove
+	plan.invalid = invalid
+
+	// the jobs of the clusters without machines left are killed too
+	for id, site := range clustersJobsSite {
+		if _, ok := plan.Jobs[id]; !ok {
+			plan.Jobs[id] = site
+			plan.credentials[id] = clustersJobsCredentials[id]
+		}
+	}
+
+	return plan, nil
+}
+
+// RemoveCluster remove the selected machines and kill their jobs
 func (c *RemoveClusterCommand) RemoveCluster() error {
 	// create a new libmachine client
 	client := libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
 	defer client.Close()
 
-	// store jobs ID to kill
-	jobsToKill := make(map[int]bool)
+	// load hosts from libmachine storage
+	lst, _, err := persist.LoadAllHosts(client)
+	if err != nil {
+		return err
+	}
 
-	for _, arg := range c.cli.Args() {
-		// convert argument to int
-		jobID, err := strconv.Atoi(arg)
-		if err != nil {
-			return fmt.Errorf("The given parameter '%s' is not a valid job ID", arg)
-		}
+	// get the machines and jobs to remove
+	plan, err := c.planRemoval(lst)
+	if err != nil {
+		return err
+	}
 
-		// append job ID to list of jobs to kill
-		jobsToKill[jobID] = true
+	if len(plan.Machines) == 0 && len(plan.Jobs) == 0 && len(plan.Clusters) == 0 && len(plan.invalid) == 0 {
+		return fmt.Errorf("No machine matches the given selection")
+	}
+
+	// the standard output may be reserved to the events stream
+	out := reportWriter(c.cli.String("events"), c.cli.String("events-file"))
+
+	// only print the removal plan in dry run mode
+	if c.cli.Bool("dry-run") {
+		printRemovalPlan(out, plan)
+		return nil
 	}
 
 	// if confirmation is enabled (default behavior)
 	if !c.cli.Bool("no-confirm") {
 		// warn user before starting
-		log.Infof("About to remove all associated machine(s) for job(s) ID : %s", strings.Join(c.cli.Args(), ", "))
+		log.Info("About to remove the following machine(s) and job(s) :")
+		printRemovalPlan(out, plan)
 		log.Warn("WARNING: This action terminate the resource reservation(s) and the node(s) will be unavailable !")
 
 		// ask for confirmation
@@ -78,47 +377,172 @@ func (c *RemoveClusterCommand) RemoveCluster() error {
 		}
 	}
 
-	// load hosts from libmachine storage
-	lst, _, err := persist.LoadAllHosts(client)
-	if err != nil {
-		return err
+	// kill the jobs and remove the machines
+	results := c.executeRemovalPlan(client, plan)
+
+	// print the removal report
+	printRemovalReport(out, results)
+
+	// count failures
+	failures := 0
+	for _, r := range results {
+		if r.Err != nil {
+			failures++
+		}
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d failure(s) while removing the cluster(s), see the removal report", failures)
 	}
 
-	// store already deleted jobs to minimize API calls
+	return nil
+}
+
+// killJob kill the job using a new API client, a job already ended is not a failure
+func killJob(id int, site string, credentials g5kCredentials) removalResult {
+	result := removalResult{Kind: "job", Name: strconv.Itoa(id), Site: site, Status: "killed"}
+
+	g5kAPI := g5k.Init(credentials.username, credentials.password)
+	if err := g5kAPI.KillJob(site, id); err != nil {
+		// the API refuses to kill ended jobs
+		if status, stateErr := g5kAPI.GetJobStatus(site, id); stateErr == nil && status.IsEnded() {
+			result.Status = "already " + status.State
+			return result
+		}
+
+		result.Status = "failed"
+		result.Err = err
+	}
+
+	return result
+}
+
+// executeRemovalPlan kill the jobs and remove the machines of the plan, it continues on failures and returns the results
+func (c *RemoveClusterCommand) executeRemovalPlan(client *libmachine.Client, plan *removalPlan) []removalResult {
+	results := []removalResult{}
+
+	jobIDs := make([]int, 0, len(plan.Jobs))
+	for id := range plan.Jobs {
+		jobIDs = append(jobIDs, id)
+	}
+	sort.Ints(jobIDs)
+
+	// kill the jobs
 	killedJobs := make(map[int]bool)
+	for _, id := range jobIDs {
+		r := killJob(id, plan.Jobs[id], plan.credentials[id])
+		results = append(results, r)
+		if r.Err != nil {
+			log.Errorf("Unable to kill job '%d' on site '%s': %s", id, r.Site, r.Err)
+			continue
+		}
 
-	// remove hosts from libmachine storage
-	for _, h := range lst {
-		// only remove Grid5000 nodes
-		if h.DriverName == "g5k" {
-			// get machine's driver configuration
-			driverConfig, err := GetG5kDriverConfig(h.RawDriver)
-			if err != nil {
-				log.Errorf("Cannot remove node '%s' : %s", h.Name, err)
-			}
+		killedJobs[id] = true
+		log.Infof("Job '%d' %s", id, r.Status)
+		c.events.Emit(events.Event{Type: events.JobKilled, Site: r.Site, JobID: id, Message: r.Status})
+	}
 
-			// skip nodes with Job ID not in the list of jobs to kill
-			if _, exist := jobsToKill[driverConfig.G5kJobID]; !exist {
-				continue
-			}
+	// remove the machines of the killed jobs from libmachine storage (the machines of the other jobs are still usable)
+	for _, m := range plan.Machines {
+		if !killedJobs[m.JobID] {
+			results = append(results, removalResult{Kind: "machine", Name: m.Name, Site: m.Site, Status: "skipped", Err: fmt.Errorf("Job '%d' not killed", m.JobID)})
+			continue
+		}
 
-			// check the job is already in the list of deleted jobs
-			if _, exist := killedJobs[driverConfig.G5kJobID]; !exist {
-				// send API call to kill job
-				driverConfig.G5kAPI.KillJob(driverConfig.G5kJobID)
+		if err := client.Remove(m.Name); err != nil {
+			log.Errorf("Error while removing '%s' machine: %s", m.Name, err)
+			results = append(results, removalResult{Kind: "machine", Name: m.Name, Site: m.Site, Status: "failed", Err: err})
+			continue
+		}
 
-				// add job ID to list of deleted jobs
-				killedJobs[driverConfig.G5kJobID] = true
+		results = append(results, removalResult{Kind: "machine", Name: m.Name, Site: m.Site, Status: "removed"})
+		log.Infof("Node '%s' removed", m.Name)
+		c.events.Emit(events.Event{Type: events.MachineRemoved, Site: m.Site, JobID: m.JobID, Machine: m.Name})
+	}
 
-				log.Infof("Job '%v' killed", driverConfig.G5kJobID)
-			}
+	// remove the machines with an unreadable driver configuration from libmachine storage (there is no job to kill)
+	for _, m := range plan.invalid {
+		if err := client.Remove(m.Name); err != nil {
+			log.Errorf("Error while removing '%s' machine: %s", m.Name, err)
+			results = append(results, removalResult{Kind: "machine", Name: m.Name, Status: "failed", Err: err})
+			continue
+		}
+
+		results = append(results, removalResult{Kind: "machine", Name: m.Name, Status: "removed (unreadable configuration)"})
+		log.Infof("Node '%s' removed", m.Name)
+		c.events.Emit(events.Event{Type: events.MachineRemoved, Machine: m.Name})
+	}
+
+	// the state of the requested clusters is removed only if all their jobs are killed (kept to retry otherwise)
+	clustersToRemove := make(map[string]bool)
+	if len(killedJobs) == len(jobIDs) {
+		for _, name := range plan.Clusters {
+			clustersToRemove[name] = true
+		}
+	}
+
+	if err := c.updateClustersState(clustersToRemove, killedJobs); err != nil {
+		results = append(results, removalResult{Kind: "cluster", Name: strings.Join(plan.Clusters, ", "), Status: "failed", Err: err})
+	}
+
+	return results
+}
 
-			// remove node from libmachine storage
-			if err := client.Remove(h.Name); err != nil {
-				return fmt.Errorf("Operation aborted. Error while removing '%s' machine: '%s'", h.Name, err)
+// printRemovalReport print the result of each job kill and machine removal
+func printRemovalReport(out io.Writer, results []removalResult) {
+	// output writer with automatic tab handling
+	w := tabwriter.NewWriter(out, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "TYPE\tNAME\tSITE\tRESULT\tERROR\n")
+
+	for _, r := range results {
+		errMsg := "-"
+		if r.Err != nil {
+			errMsg = r.Err.Error()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Kind, r.Name, valueOrDash(r.Site), r.Status, errMsg)
+	}
+
+	w.Flush()
+}
+
+// updateClustersState remove the killed jobs from the clusters state, and the state of clusters without jobs left
+func (c *RemoveClusterCommand) updateClustersState(clustersToRemove map[string]bool, killedJobs map[int]bool) error {
+	clusterNames, err := cluster.ListClusters()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range clusterNames {
+		cl, err := cluster.LoadCluster(name)
+		if err != nil {
+			log.Warnf("Unable to update the state of cluster '%s': %s", name, err)
+			continue
+		}
+		cl.Config.LibMachineClient.Close()
+
+		// remove killed jobs from the cluster
+		nbJobs := len(cl.Jobs)
+		for jobID := range killedJobs {
+			cl.RemoveJob(jobID)
+		}
+
+		// remove the cluster if requested or if all its jobs are killed
+		if clustersToRemove[name] || (nbJobs > 0 && len(cl.Jobs) == 0) {
+			if err := cl.RemoveState(); err != nil {
+				return err
 			}
 
-			log.Infof("Node '%s' removed", h.Name)
+			log.Infof("Cluster '%s' removed", name)
+			c.events.Emit(events.Event{Type: events.ClusterRemoved, Cluster: name})
+			continue
+		}
+
+		// save the remaining jobs of the cluster
+		if len(cl.Jobs) != nbJobs {
+			if err := cl.Save(); err != nil {
+				return err
+			}
 		}
 	}
 
@@ -134,5 +558,13 @@ func RunRemoveClusterCommand(cli *cli.Context) error {
 		return err
 	}
 
+	// write the lifecycle events if enabled
+	c.events = events.NewEmitter("")
+	closeEvents, err := openEventsStream(c.events, c.cli.String("events"), c.cli.String("events-file"))
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+
 	return c.RemoveCluster()
 }
@@ -0,0 +1,82 @@
+package command
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testRemovalMachines returns machines of two jobs on two sites, and a machine of another job on the first site
+func testRemovalMachines() []removalMachine {
+	return []removalMachine{
+		{Name: "exp-nantes-1", Site: "nantes", JobID: 111111},
+		{Name: "exp-nantes-0", Site: "nantes", JobID: 111111},
+		{Name: "exp-lille-0", Site: "lille", JobID: 222222},
+		{Name: "test-nantes", Site: "nantes", JobID: 333333},
+	}
+}
+
+func TestNewRemovalPlanJobID(t *testing.T) {
+	plan := newRemovalPlan(testRemovalMachines(), &removalSelector{jobs: map[int]bool{111111: true}})
+	assert.Equal(t, map[int]string{111111: "nantes"}, plan.Jobs)
+	assert.Equal(t, []removalMachine{{Name: "exp-nantes-0", Site: "nantes", JobID: 111111}, {Name: "exp-nantes-1", Site: "nantes", JobID: 111111}}, plan.Machines)
+}
+
+func TestNewRemovalPlanPatternSelectsWholeJob(t *testing.T) {
+	plan := newRemovalPlan(testRemovalMachines(), &removalSelector{patterns: []string{"exp-nantes-1"}})
+	assert.Equal(t, map[int]string{111111: "nantes"}, plan.Jobs)
+	assert.Len(t, plan.Machines, 2)
+}
+
+func TestNewRemovalPlanSite(t *testing.T) {
+	plan := newRemovalPlan(testRemovalMachines(), &removalSelector{sites: map[string]bool{"nantes": true}})
+	assert.Equal(t, map[int]string{111111: "nantes", 333333: "nantes"}, plan.Jobs)
+	assert.Len(t, plan.Machines, 3)
+}
+
+func TestNewRemovalPlanPatternAndSite(t *testing.T) {
+	plan := newRemovalPlan(testRemovalMachines(), &removalSelector{patterns: []string{"exp-*"}, sites: map[string]bool{"lille": true}})
+	assert.Equal(t, map[int]string{222222: "lille"}, plan.Jobs)
+	assert.Equal(t, []removalMachine{{Name: "exp-lille-0", Site: "lille", JobID: 222222}}, plan.Machines)
+}
+
+func TestPrintRemovalPlan(t *testing.T) {
+	plan := newRemovalPlan(testRemovalMachines(), &removalSelector{patterns: []string{"exp-*"}})
+	plan.Clusters = []string{"exp"}
+
+	var buf bytes.Buffer
+	printRemovalPlan(&buf, plan)
+	assert.Contains(t, buf.String(), "exp-nantes-0, exp-nantes-1")
+	assert.Contains(t, buf.String(), "222222")
+	assert.NotContains(t, buf.String(), "test-nantes")
+	assert.Contains(t, buf.String(), "Cluster(s) state to remove: exp")
+}
+
+func TestNewRemovalPlanCredentials(t *testing.T) {
+	machines := testRemovalMachines()
+	machines[2].credentials = g5kCredentials{username: "user", password: "pass"}
+
+	plan := newRemovalPlan(machines, &removalSelector{sites: map[string]bool{"lille": true}})
+	assert.Equal(t, map[int]g5kCredentials{222222: {username: "user", password: "pass"}}, plan.credentials)
+}
+
+func TestPrintRemovalReport(t *testing.T) {
+	var buf bytes.Buffer
+	printRemovalReport(&buf, []removalResult{
+		{Kind: "job", Name: "111111", Site: "nantes", Status: "killed"},
+		{Kind: "machine", Name: "exp-nantes-0", Site: "nantes", Status: "failed", Err: fmt.Errorf("permission denied")},
+	})
+	assert.Contains(t, buf.String(), "killed")
+	assert.Contains(t, buf.String(), "permission denied")
+}
+
+func TestCheckConfirmationParameters(t *testing.T) {
+	// the prompt would be written to the events stream
+	assert.Error(t, checkConfirmationParameters("json", "", false))
+	assert.NoError(t, checkConfirmationParameters("json", "", true))
+
+	assert.NoError(t, checkConfirmationParameters("json", "events.json", false))
+	assert.NoError(t, checkConfirmationParameters("", "", false))
+}
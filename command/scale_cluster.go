@@ -0,0 +1,366 @@
+package command
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Songmu/prompter"
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine/log"
+	"github.com/kujtimiihoxha/go-brace-expansion"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+)
+
+var (
+	// ScaleClusterCliCommand represent the CLI command "scale-cluster" with its flags
+	ScaleClusterCliCommand = cli.Command{
+		Name:      "scale-cluster",
+		Aliases:   []string{"scale", "s"},
+		Usage:     "Add nodes to or remove nodes from an existing cluster",
+		ArgsUsage: "cluster name",
+		Action:    RunScaleClusterCommand,
+		Flags: append([]cli.Flag{
+			cli.StringSliceFlag{
+				EnvVar: "G5K_SCALE_ADD",
+				Name:   "add",
+				Usage:  "Reserve new nodes on a site and add them to the cluster (ex: lille:8)",
+			},
+
+			cli.StringSliceFlag{
+				EnvVar: "G5K_SCALE_REMOVE",
+				Name:   "remove",
+				Usage:  "Drain the selected node(s) and remove them from the cluster (ex: lille-{10..15})",
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_RM_NO_CONFIRM",
+				Name:   "no-confirm",
+				Usage:  "Disable confirmation before removing nodes",
+			},
+		}, clusterBuildFlags...),
+	}
+)
+
+// ScaleClusterCommand contain global parameters for the command "scale-cluster"
+type ScaleClusterCommand struct {
+	cli *cli.Context
+}
+
+// checkCliParameters perform checks on CLI parameters
+func (c *ScaleClusterCommand) checkCliParameters() error {
+	// check cluster name
+	if c.cli.NArg() != 1 {
+		return fmt.Errorf("You must provide the name of the cluster to scale")
+	}
+
+	// check nodes to add or remove
+	if len(c.cli.StringSlice("add")) < 1 && len(c.cli.StringSlice("remove")) < 1 {
+		return fmt.Errorf("You must provide the nodes to add or to remove")
+	}
+
+	// block adding and removing nodes at the same time
+	if len(c.cli.StringSlice("add")) > 0 && len(c.cli.StringSlice("remove")) > 0 {
+		return fmt.Errorf("You can't add and remove nodes at the same time")
+	}
+
+	// check events stream parameters
+	if err := checkEventsParameters(c.cli.String("events"), c.cli.String("events-file")); err != nil {
+		return err
+	}
+
+	// check confirmation parameters
+	if len(c.cli.StringSlice("remove")) > 0 {
+		if err := checkConfirmationParameters(c.cli.String("events"), c.cli.String("events-file"), c.cli.Bool("no-confirm")); err != nil {
+			return err
+		}
+	}
+
+	// check nodes reservation and provisionning parameters
+	if len(c.cli.StringSlice("add")) > 0 {
+		if err := checkClusterBuildParameters(c.cli); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseNodesFlag parse a nodes flag (site)-(id)
+func (c *ScaleClusterCommand) parseNodesFlag(flag []string) ([]string, error) {
+	// store nodes without duplicates
+	nodes := make(map[string]bool)
+
+	for _, paramValue := range flag {
+		// brace expansion support
+		for _, n := range gobrex.Expand(paramValue) {
+			// extract site and node ID
+			v, err := ParseCliFlag("^"+regexNodeName+"$", n)
+			if err != nil {
+				return nil, fmt.Errorf("Syntax error in nodes parameter: '%s'", paramValue)
+			}
+
+			nodes[v["nodeName"]] = true
+		}
+	}
+
+	// returns sorted nodes name
+	nodesName := make([]string, 0, len(nodes))
+	for n := range nodes {
+		nodesName = append(nodesName, n)
+	}
+	sort.Strings(nodesName)
+
+	return nodesName, nil
+}
+
+// scaleOut reserve, deploy and provision new nodes, then update the static lookup table of all the nodes
+func (c *ScaleClusterCommand) scaleOut(cl *cluster.Cluster) error {
+	// parse nodes to add (same format as the nodes reservation)
+	nodesReservation, err := (&CreateClusterCommand{}).parseReserveNodesFlag(c.cli.StringSlice("add"))
+	if err != nil {
+		return err
+	}
+
+	// create Grid5000 API client using the cluster credentials
+	g5kAPI := g5k.Init(cl.Config.G5kUsername, cl.Config.G5kPassword)
+
+	// Check VPN connection for all requested sites
+	if err := g5kAPI.CheckVpnConnection(nodesReservation); err != nil {
+		return err
+	}
+
+	// add the new nodes and their jobs to the cluster (sorted by site for a stable order)
+	sites := make([]string, 0, len(nodesReservation))
+	for site := range nodesReservation {
+		sites = append(sites, site)
+	}
+	sort.Strings(sites)
+
+	for _, site := range sites {
+		if nodesReservation[site] < 1 {
+			return fmt.Errorf("You must add at least one node on site '%s'", site)
+		}
+	}
+
+	addedJobs := []*cluster.Job{}
+	addedMachines := []string{}
+	for _, site := range sites {
+		machineNames := cl.AddNodes(site, nodesReservation[site])
+		addedJobs = append(addedJobs, cl.AddJob(site, nodesReservation[site]))
+		addedMachines = append(addedMachines, machineNames...)
+
+		log.Infof("Adding %d nodes on '%s' site ('%s' to '%s')...", len(machineNames), site, machineNames[0], machineNames[len(machineNames)-1])
+	}
+
+	if err := cl.Save(); err != nil {
+		return err
+	}
+
+	// the new jobs go through the cluster creation phases, the existing nodes are already provisioned
+	cc := CreateClusterCommand{cli: c.cli}
+	if err := cc.buildCluster(g5kAPI, cl, false); err != nil {
+		c.removeFailedNodes(cl, addedJobs, addedMachines)
+		if saveErr := cl.Save(); saveErr != nil {
+			log.Errorf("Unable to save the state of cluster '%s': %s", cl.Name, saveErr)
+		}
+
+		return err
+	}
+
+	// add the new nodes to the static lookup table of all the nodes
+	log.Info("Updating the static lookup table of the nodes...")
+	return cl.UpdateNodesHostsMapping()
+}
+
+// removeFailedNodes removes the added nodes not provisionned and the added jobs without nodes from the cluster state (after a failed or rolled back scale out)
+func (c *ScaleClusterCommand) removeFailedNodes(cl *cluster.Cluster, addedJobs []*cluster.Job, addedMachines []string) {
+	// remove the nodes not provisionned, and their machine if it was created
+	for _, machineName := range addedMachines {
+		n, ok := cl.Nodes[machineName]
+		if !ok || n.Provisioned {
+			continue
+		}
+
+		if exists, err := cl.Config.LibMachineClient.Exists(machineName); err == nil && exists {
+			if err := cl.Config.LibMachineClient.Remove(machineName); err != nil {
+				log.Errorf("Error while removing '%s' machine: %s", machineName, err)
+			}
+		}
+
+		cl.RemoveNode(machineName)
+	}
+
+	// remove the jobs without nodes left
+	for _, j := range addedJobs {
+		used := false
+		for _, n := range cl.Nodes {
+			if j.ID != 0 && n.G5kJobID == j.ID {
+				used = true
+			}
+		}
+
+		if used {
+			continue
+		}
+
+		if j.ID != 0 {
+			log.Warnf("The job '%d' on site '%s' has no provisionned node, run 'gc' to kill it", j.ID, j.Site)
+		}
+
+		cl.DropJob(j)
+	}
+}
+
+// scaleIn drain the selected nodes and remove them from the cluster, the jobs without nodes left are killed
+func (c *ScaleClusterCommand) scaleIn(cl *cluster.Cluster) error {
+	// parse nodes to remove
+	nodes, err := c.parseNodesFlag(c.cli.StringSlice("remove"))
+	if err != nil {
+		return err
+	}
+
+	// get the nodes machine
+	removedNodes := make(map[string]bool)
+	machineNames := []string{}
+	for _, node := range nodes {
+		machineName := cl.GetMachineName(node)
+		if _, ok := cl.Nodes[machineName]; !ok {
+			return fmt.Errorf("The node '%s' does not exist", node)
+		}
+
+		// Swarm standalone masters run the cluster discovery service
+		if cl.Config.SwarmStandaloneGlobalConfig != nil {
+			for _, m := range cl.Config.SwarmMasterNode {
+				if m == machineName {
+					return fmt.Errorf("The Swarm standalone master node '%s' can't be removed", node)
+				}
+			}
+		}
+
+		removedNodes[machineName] = true
+		machineNames = append(machineNames, machineName)
+	}
+
+	// a Swarm mode manager must remain in the cluster to drain the nodes
+	var master *cluster.Node
+	if cl.Config.SwarmModeGlobalConfig != nil {
+		master, err = cl.GetRemainingSwarmMaster(removedNodes)
+		if err != nil {
+			return err
+		}
+	}
+
+	// if confirmation is enabled (default behavior)
+	if !c.cli.Bool("no-confirm") {
+		// warn user before starting
+		log.Infof("About to remove the machine(s): %s", strings.Join(machineNames, ", "))
+		log.Warn("WARNING: The node(s) will be drained and removed from the Swarm cluster !")
+
+		// ask for confirmation
+		if !prompter.YN("Are you sure?", false) {
+			return fmt.Errorf("The operation was canceled by the user")
+		}
+	}
+
+	// write the lifecycle events if enabled
+	em := events.NewEmitter(cl.Name)
+	closeEvents, err := openEventsStream(em, c.cli.String("events"), c.cli.String("events-file"))
+	if err != nil {
+		return err
+	}
+	defer closeEvents()
+
+	// jobs of the removed nodes
+	jobs := make(map[int]bool)
+
+	// decommission the nodes
+	failures := []string{}
+	for _, machineName := range machineNames {
+		n := cl.Nodes[machineName]
+		if err := cl.DecommissionNode(n, master); err != nil {
+			log.Errorf("Unable to remove node '%s' ('%s'): %s", n.NodeName, machineName, err)
+			failures = append(failures, machineName)
+			continue
+		}
+
+		jobs[n.G5kJobID] = true
+		cl.RemoveNode(machineName)
+
+		log.Infof("Node '%s' ('%s') removed", n.NodeName, machineName)
+		em.Emit(events.Event{Type: events.MachineRemoved, Site: n.G5kSite, JobID: n.G5kJobID, Machine: machineName})
+	}
+
+	// kill the jobs without nodes left
+	g5kAPI := g5k.Init(cl.Config.G5kUsername, cl.Config.G5kPassword)
+	for _, j := range cl.Jobs {
+		if !jobs[j.ID] || j.ID == 0 {
+			continue
+		}
+
+		remaining := 0
+		for _, n := range cl.Nodes {
+			if n.G5kJobID == j.ID {
+				remaining++
+			}
+		}
+
+		if remaining > 0 {
+			log.Infof("The resources of job '%d' on site '%s' stay reserved until the end of the job (%d node(s) left in the job)", j.ID, j.Site, remaining)
+			continue
+		}
+
+		if err := g5kAPI.KillJob(j.Site, j.ID); err != nil {
+			log.Errorf("Unable to kill job '%d' on site '%s': %s", j.ID, j.Site, err)
+			failures = append(failures, fmt.Sprintf("job %d", j.ID))
+			continue
+		}
+
+		cl.RemoveJob(j.ID)
+		log.Infof("Job '%d' on site '%s' killed", j.ID, j.Site)
+		em.Emit(events.Event{Type: events.JobKilled, Site: j.Site, JobID: j.ID})
+	}
+
+	// save the cluster state
+	if err := cl.Save(); err != nil {
+		return err
+	}
+
+	// remove the nodes from the static lookup table of the remaining nodes
+	log.Info("Updating the static lookup table of the nodes...")
+	if err := cl.UpdateNodesHostsMapping(); err != nil {
+		return err
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("Unable to remove: %s", strings.Join(failures, ", "))
+	}
+
+	return nil
+}
+
+// RunScaleClusterCommand add or remove nodes of a cluster
+func RunScaleClusterCommand(cli *cli.Context) error {
+	c := ScaleClusterCommand{cli: cli}
+
+	// check CLI parameters
+	if err := c.checkCliParameters(); err != nil {
+		return err
+	}
+
+	// load cluster state
+	cl, err := cluster.LoadCluster(c.cli.Args().First())
+	if err != nil {
+		return err
+	}
+	defer cl.Config.LibMachineClient.Close()
+
+	if len(c.cli.StringSlice("remove")) > 0 {
+		return c.scaleIn(cl)
+	}
+
+	return c.scaleOut(cl)
+}
@@ -4,8 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Spirals-Team/docker-machine-driver-g5k/driver"
+	"github.com/docker/machine/drivers/none"
+	"github.com/docker/machine/libmachine/host"
+	"github.com/docker/machine/libmachine/persist"
 )
 
 // ParseCliFlag extract informations (using regex) from cli flags and returns a map (named capturing groups are required)
@@ -48,3 +54,60 @@ func GetG5kDriverConfig(rawDriver []byte) (*driver.Driver, error) {
 
 	return &drv, nil
 }
+
+// UpdateG5kDriverConfig change the given fields of a machine's g5k driver configuration in the store (the other fields are kept as is)
+func UpdateG5kDriverConfig(store *persist.Filestore, machineName string, fields map[string]interface{}) error {
+	// load the machine without starting its driver plugin
+	h, err := store.Load(machineName)
+	if err != nil {
+		return err
+	}
+
+	// update raw driver configuration
+	var rawDriver map[string]interface{}
+	if err := json.Unmarshal(h.RawDriver, &rawDriver); err != nil {
+		return err
+	}
+
+	for k, v := range fields {
+		rawDriver[k] = v
+	}
+
+	data, err := json.Marshal(rawDriver)
+	if err != nil {
+		return err
+	}
+
+	// save the machine with the new driver configuration
+	h.Driver = &host.RawDataDriver{Driver: none.NewDriver(h.Name, store.Path), Data: data}
+	return store.Save(h)
+}
+
+// ParseWalltime convert a walltime (hh:mm:ss, hh:mm or hh) to a duration
+func ParseWalltime(walltime string) (time.Duration, error) {
+	parts := strings.Split(walltime, ":")
+	if walltime == "" || len(parts) > 3 {
+		return 0, fmt.Errorf("Syntax error in walltime: '%s'", walltime)
+	}
+
+	// hours, minutes and seconds
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+
+	var d time.Duration
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("Syntax error in walltime: '%s'", walltime)
+		}
+
+		d += time.Duration(v) * units[i]
+	}
+
+	return d, nil
+}
+
+// FormatWalltime convert a duration to a walltime (hh:mm:ss)
+func FormatWalltime(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -3,6 +3,7 @@ package command
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -39,3 +40,25 @@ func TestParseCliFlagRegexWithNamedCapturingGroupEmpty(t *testing.T) {
 
 	assert.Error(t, err)
 }
+
+func TestParseWalltimeCorrect(t *testing.T) {
+	d, err := ParseWalltime("2:30:15")
+	assert.NoError(t, err)
+	assert.Equal(t, 2*time.Hour+30*time.Minute+15*time.Second, d)
+
+	d, err = ParseWalltime("36:00")
+	assert.NoError(t, err)
+	assert.Equal(t, 36*time.Hour, d)
+}
+
+func TestParseWalltimeIncorrect(t *testing.T) {
+	for _, w := range []string{"", "1:00:00:00", "a:00:00", "1:-1:00"} {
+		_, err := ParseWalltime(w)
+		assert.Error(t, err, w)
+	}
+}
+
+func TestFormatWalltime(t *testing.T) {
+	assert.Equal(t, "1:00:00", FormatWalltime(time.Hour))
+	assert.Equal(t, "26:05:09", FormatWalltime(26*time.Hour+5*time.Minute+9*time.Second))
+}
@@ -0,0 +1,411 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/docker/machine/libmachine/log"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/cluster"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/g5k"
+)
+
+var (
+	// WatchClusterCliCommand represent the CLI command "watch-cluster" with its flags
+	WatchClusterCliCommand = cli.Command{
+		Name:      "watch-cluster",
+		Aliases:   []string{"watch", "w"},
+		Usage:     "Watch the remaining walltime of the clusters jobs and warn before they end",
+		ArgsUsage: "[cluster name...]",
+		Action:    RunWatchClusterCommand,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				EnvVar: "G5K_WATCH_WARN_AT",
+				Name:   "warn-at",
+				Usage:  "Comma separated remaining walltimes at which a warning is printed (ex: 30m,10m)",
+				Value:  "30m,10m",
+			},
+
+			cli.DurationFlag{
+				EnvVar: "G5K_WATCH_INTERVAL",
+				Name:   "interval",
+				Usage:  "Delay between two checks of the jobs",
+				Value:  time.Minute,
+			},
+
+			cli.BoolFlag{
+				EnvVar: "G5K_WATCH_ONCE",
+				Name:   "once",
+				Usage:  "Print the status of the jobs and exit",
+			},
+
+			cli.StringFlag{
+				EnvVar: "G5K_WATCH_HOOK",
+				Name:   "hook",
+				Usage:  "Shell command to run when a warning threshold is reached (ex: to checkpoint results)",
+				Value:  "",
+			},
+
+			cli.DurationFlag{
+				EnvVar: "G5K_WATCH_HOOK_TIMEOUT",
+				Name:   "hook-timeout",
+				Usage:  "Maximum duration of the hook command, it is killed after this delay",
+				Value:  10 * time.Minute,
+			},
+
+			cli.StringFlag{
+				EnvVar: "G5K_WATCH_AUTO_EXTEND",
+				Name:   "auto-extend",
+				Usage:  "Walltime change (+hh:mm:ss) requested when the lowest warning threshold is reached",
+				Value:  "",
+			},
+
+			cli.IntFlag{
+				EnvVar: "G5K_WATCH_AUTO_EXTEND_MAX",
+				Name:   "auto-extend-max",
+				Usage:  "Maximum number of automatic walltime changes per job",
+				Value:  1,
+			},
+		},
+	}
+)
+
+// WatchClusterCommand contain global parameters for the command "watch-cluster"
+type WatchClusterCommand struct {
+	cli        *cli.Context
+	thresholds []time.Duration
+
+	// hooks running in background
+	hooks sync.WaitGroup
+}
+
+// watchedJob contains the watch state of a job of a cluster
+type watchedJob struct {
+	cluster    string
+	site       string
+	id         int
+	g5kAPI     *g5k.G5K
+	warned     time.Duration // lowest threshold already warned (0 if none)
+	extensions int
+}
+
+// checkCliParameters perform checks on CLI parameters
+func (c *WatchClusterCommand) checkCliParameters() error {
+	// check warning thresholds
+	thresholds, err := parseThresholds(c.cli.String("warn-at"))
+	if err != nil {
+		return err
+	}
+	c.thresholds = thresholds
+
+	// check interval
+	if c.cli.Duration("interval") <= 0 {
+		return fmt.Errorf("The interval must be positive")
+	}
+
+	// check hook timeout
+	if c.cli.Duration("hook-timeout") <= 0 {
+		return fmt.Errorf("The hook timeout must be positive")
+	}
+
+	// check automatic walltime change
+	if e := c.cli.String("auto-extend"); e != "" {
+		if !strings.HasPrefix(e, "+") {
+			return fmt.Errorf("The automatic walltime change must be an increase (+hh:mm:ss): '%s'", e)
+		}
+
+		if _, err := computeNewWalltime("1:00:00", e); err != nil {
+			return err
+		}
+
+		if len(c.thresholds) == 0 {
+			return fmt.Errorf("The automatic walltime change requires at least one warning threshold")
+		}
+	}
+
+	if c.cli.Int("auto-extend-max") < 0 {
+		return fmt.Errorf("The maximum number of automatic walltime changes can't be negative")
+	}
+
+	return nil
+}
+
+// parseThresholds returns the comma separated durations sorted from the highest to the lowest
+func parseThresholds(value string) ([]time.Duration, error) {
+	thresholds := []time.Duration{}
+	for _, v := range strings.Split(value, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("Syntax error in warning threshold: '%s'", v)
+		}
+
+		thresholds = append(thresholds, d)
+	}
+
+	sort.Slice(thresholds, func(i, j int) bool { return thresholds[i] > thresholds[j] })
+
+	return thresholds, nil
+}
+
+// crossedThreshold returns the lowest threshold reached by the remaining walltime (0 if none)
+func crossedThreshold(thresholds []time.Duration, remaining time.Duration) time.Duration {
+	crossed := time.Duration(0)
+	for _, t := range thresholds {
+		if remaining <= t {
+			crossed = t
+		}
+	}
+
+	return crossed
+}
+
+// loadWatchedJobs returns the submitted jobs of the given clusters (all clusters by default)
+func (c *WatchClusterCommand) loadWatchedJobs() ([]*watchedJob, error) {
+	clusterNames := c.cli.Args()
+	if len(clusterNames) == 0 {
+		names, err := cluster.ListClusters()
+		if err != nil {
+			return nil, err
+		}
+
+		clusterNames = names
+	}
+
+	jobs := []*watchedJob{}
+	for _, name := range clusterNames {
+		cl, err := cluster.LoadCluster(name)
+		if err != nil {
+			return nil, err
+		}
+		cl.Config.LibMachineClient.Close()
+
+		g5kAPI := g5k.Init(cl.Config.G5kUsername, cl.Config.G5kPassword)
+		for _, j := range cl.Jobs {
+			// skip jobs not submitted
+			if j.ID == 0 {
+				continue
+			}
+
+			jobs = append(jobs, &watchedJob{cluster: name, site: j.Site, id: j.ID, g5kAPI: g5kAPI})
+		}
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("No job to watch")
+	}
+
+	return jobs, nil
+}
+
+// runHook run the hook command with the job informations in its environment, the command is killed after the hook timeout
+func (c *WatchClusterCommand) runHook(j *watchedJob, threshold time.Duration, remaining time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cli.Duration("hook-timeout"))
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", c.cli.String("hook"))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"G5K_CLUSTER="+j.cluster,
+		"G5K_SITE="+j.site,
+		"G5K_JOB_ID="+strconv.Itoa(j.id),
+		"G5K_THRESHOLD="+strconv.Itoa(int(threshold.Seconds())),
+		"G5K_REMAINING="+strconv.Itoa(int(remaining.Seconds())),
+	)
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("Timeout after %s", c.cli.Duration("hook-timeout"))
+		}
+
+		log.Errorf("The hook of job '%d' of cluster '%s' failed: %s", j.id, j.cluster, err)
+	}
+}
+
+// autoExtend request the automatic walltime change of the job if the policy allows it, and update the walltime of its machines and cluster
+func (c *WatchClusterCommand) autoExtend(j *watchedJob) {
+	if c.cli.String("auto-extend") == "" || j.extensions >= c.cli.Int("auto-extend-max") {
+		return
+	}
+	j.extensions++
+
+	// load cluster state
+	cl, err := cluster.LoadCluster(j.cluster)
+	if err != nil {
+		log.Errorf("Unable to load cluster '%s' to change the walltime of job '%d': %s", j.cluster, j.id, err)
+		return
+	}
+	defer cl.Config.LibMachineClient.Close()
+
+	var job *cluster.Job
+	for _, cj := range cl.Jobs {
+		if cj.ID == j.id {
+			job = cj
+		}
+	}
+
+	if job == nil {
+		log.Errorf("The job '%d' is no longer part of cluster '%s'", j.id, j.cluster)
+		return
+	}
+
+	change, err := changeJobWalltime(j.g5kAPI, cl, job, c.cli.String("auto-extend"))
+	if err != nil {
+		log.Errorf("The walltime change of job '%d' of cluster '%s' was refused: %s", j.id, j.cluster, err)
+		return
+	}
+
+	if change.Pending {
+		log.Warnf("Walltime change '%s' of job '%d' of cluster '%s' pending: %s (walltime: %s) (%d/%d)", c.cli.String("auto-extend"), j.id, j.cluster, change.Status, valueOrDash(change.Granted), j.extensions, c.cli.Int("auto-extend-max"))
+	} else {
+		log.Infof("Walltime change '%s' of job '%d' of cluster '%s' accepted: %s (walltime: %s) (%d/%d)", c.cli.String("auto-extend"), j.id, j.cluster, change.Status, change.Granted, j.extensions, c.cli.Int("auto-extend-max"))
+	}
+
+	// update the cluster walltime with the walltime granted to its jobs
+	if err := updateClusterWalltime(j.g5kAPI, cl); err != nil {
+		log.Errorf("Unable to update the walltime of cluster '%s': %s", j.cluster, err)
+	}
+}
+
+// checkJob warn if the remaining walltime of the job reached a threshold not warned yet, and returns false if the job is ended
+func (c *WatchClusterCommand) checkJob(j *watchedJob, status *g5k.JobStatus, now time.Time) bool {
+	if status.IsEnded() {
+		log.Warnf("Job '%d' of cluster '%s' on site '%s' is %s", j.id, j.cluster, j.site, status.State)
+		return false
+	}
+
+	// the job is not running yet
+	if status.State != "running" {
+		return true
+	}
+
+	// the job was extended above the warned thresholds
+	remaining := status.Remaining(now)
+	threshold := crossedThreshold(c.thresholds, remaining)
+	if threshold == 0 {
+		j.warned = 0
+		return true
+	}
+
+	if j.warned != 0 && threshold >= j.warned {
+		return true
+	}
+	j.warned = threshold
+
+	log.Warnf("Job '%d' of cluster '%s' on site '%s' ends in %s (at %s)", j.id, j.cluster, j.site, FormatWalltime(remaining), status.EndsAt().Format(g5k.ReservationDateFormat))
+
+	// the hook runs in background, the jobs are still watched while it runs
+	if c.cli.String("hook") != "" {
+		c.hooks.Add(1)
+		go func() {
+			defer c.hooks.Done()
+			c.runHook(j, threshold, remaining)
+		}()
+	}
+
+	// the walltime is extended at the lowest threshold
+	if threshold == c.thresholds[len(c.thresholds)-1] {
+		c.autoExtend(j)
+	}
+
+	return true
+}
+
+// printJobsStatus print the state, end date and remaining walltime of the jobs
+func printJobsStatus(jobs []*watchedJob, now time.Time) {
+	// output writer with automatic tab handling
+	w := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(w, "CLUSTER\tSITE\tJOB ID\tSTATE\tENDS AT\tREMAINING\n")
+
+	for _, j := range jobs {
+		status, err := j.g5kAPI.GetJobStatus(j.site, j.id)
+		if err != nil {
+			log.Warnf("Unable to get the state of job '%d' on site '%s': %s", j.id, j.site, err)
+			fmt.Fprintf(w, "%s\t%s\t%d\tunknown\t-\t-\n", j.cluster, j.site, j.id)
+			continue
+		}
+
+		endsAt, remaining := "-", "-"
+		if !status.EndsAt().IsZero() {
+			endsAt = status.EndsAt().Format(g5k.ReservationDateFormat)
+			remaining = FormatWalltime(status.Remaining(now))
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", j.cluster, j.site, j.id, status.State, endsAt, remaining)
+	}
+
+	w.Flush()
+}
+
+// WatchCluster check the jobs of the clusters until they are all ended
+func (c *WatchClusterCommand) WatchCluster() error {
+	jobs, err := c.loadWatchedJobs()
+	if err != nil {
+		return err
+	}
+
+	// only print the jobs status
+	if c.cli.Bool("once") {
+		printJobsStatus(jobs, time.Now())
+		return nil
+	}
+
+	log.Infof("Watching %d job(s), warning at %s before their end", len(jobs), c.cli.String("warn-at"))
+
+	for len(jobs) > 0 {
+		now := time.Now()
+
+		// check each job, the ended jobs are no longer watched
+		active := []*watchedJob{}
+		for _, j := range jobs {
+			status, err := j.g5kAPI.GetJobStatus(j.site, j.id)
+			if err != nil {
+				log.Warnf("Unable to get the state of job '%d' on site '%s': %s", j.id, j.site, err)
+				active = append(active, j)
+				continue
+			}
+
+			if c.checkJob(j, status, now) {
+				active = append(active, j)
+			}
+		}
+
+		jobs = active
+		if len(jobs) > 0 {
+			time.Sleep(c.cli.Duration("interval"))
+		}
+	}
+
+	log.Info("All the watched jobs are ended")
+
+	// wait the hooks still running
+	c.hooks.Wait()
+
+	return nil
+}
+
+// RunWatchClusterCommand watch the walltime of the clusters
+func RunWatchClusterCommand(cli *cli.Context) error {
+	c := WatchClusterCommand{cli: cli}
+
+	// check CLI parameters
+	if err := c.checkCliParameters(); err != nil {
+		return err
+	}
+
+	return c.WatchCluster()
+}
@@ -0,0 +1,36 @@
+package command
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := parseThresholds("10m, 30m,1h")
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Duration{time.Hour, 30 * time.Minute, 10 * time.Minute}, thresholds)
+}
+
+func TestParseThresholdsEmpty(t *testing.T) {
+	thresholds, err := parseThresholds("")
+	assert.NoError(t, err)
+	assert.Empty(t, thresholds)
+}
+
+func TestParseThresholdsInvalid(t *testing.T) {
+	_, err := parseThresholds("30m,soon")
+	assert.Error(t, err)
+
+	_, err = parseThresholds("-10m")
+	assert.Error(t, err)
+}
+
+func TestCrossedThreshold(t *testing.T) {
+	thresholds := []time.Duration{30 * time.Minute, 10 * time.Minute}
+	assert.Equal(t, time.Duration(0), crossedThreshold(thresholds, time.Hour))
+	assert.Equal(t, 30*time.Minute, crossedThreshold(thresholds, 25*time.Minute))
+	assert.Equal(t, 10*time.Minute, crossedThreshold(thresholds, 10*time.Minute))
+	assert.Equal(t, 10*time.Minute, crossedThreshold(thresholds, 0))
+}
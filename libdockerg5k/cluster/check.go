@@ -0,0 +1,309 @@
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/machine/libmachine/host"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/hostsmapping"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/kvstore"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/weave"
+)
+
+// CheckStatus is the result of a health check of a node
+type CheckStatus string
+
+const (
+	// CheckPass means the check succeeded
+	CheckPass CheckStatus = "pass"
+	// CheckFail means the check failed
+	CheckFail CheckStatus = "FAIL"
+	// CheckSkip means the check is not relevant for the node, or could not be run
+	CheckSkip CheckStatus = "skip"
+)
+
+// health checks names, in the order of the matrix columns
+const (
+	CheckEngine     = "engine"
+	CheckHosts      = "hosts"
+	CheckSwarm      = "swarm"
+	CheckContainers = "containers"
+	CheckNetwork    = "network"
+)
+
+// CheckNames contains the health checks names, in the order of the matrix columns
+var CheckNames = []string{CheckEngine, CheckHosts, CheckSwarm, CheckContainers, CheckNetwork}
+
+// CheckResult is the result of a health check of a node, with the reason of the failure or skip
+type CheckResult struct {
+	Status  CheckStatus
+	Message string
+}
+
+// NodeCheck contains the health checks results of a node
+type NodeCheck struct {
+	MachineName string
+	Results     map[string]CheckResult
+}
+
+// Failed returns true if at least one health check of the node failed
+func (nc *NodeCheck) Failed() bool {
+	for _, r := range nc.Results {
+		if r.Status == CheckFail {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkResult returns a passed check if err is nil, a failed check with the error message otherwise
+func checkResult(err error) CheckResult {
+	if err != nil {
+		return CheckResult{Status: CheckFail, Message: err.Error()}
+	}
+
+	return CheckResult{Status: CheckPass}
+}
+
+// missingContainers returns the expected containers not in the running containers list
+func missingContainers(expected []string, running []string) []string {
+	isRunning := make(map[string]bool)
+	for _, c := range running {
+		isRunning[c] = true
+	}
+
+	missing := []string{}
+	for _, c := range expected {
+		if !isRunning[c] {
+			missing = append(missing, c)
+		}
+	}
+
+	return missing
+}
+
+// expectedContainers returns the containers that should run on the node
+func (n *Node) expectedContainers() []string {
+	expected := []string{}
+
+	// Swarm standalone (containers named by Docker Machine)
+	if n.clusterConfig.SwarmStandaloneGlobalConfig != nil {
+		expected = append(expected, "swarm-agent")
+		if n.isSwarmMaster() {
+			expected = append(expected, "swarm-agent-master")
+
+			if n.clusterConfig.ClusterStore != "" {
+				if store, err := kvstore.Get(n.clusterConfig.ClusterStore); err == nil {
+					expected = append(expected, store.ContainerName())
+				}
+			}
+		}
+
+		if n.clusterConfig.WeaveNetworkingEnabled {
+			expected = append(expected, weave.NetContainerName, weave.DiscoveryContainerName)
+		}
+	}
+
+	return expected
+}
+
+// checkContainers check the expected containers are running on the node
+func (n *Node) checkContainers(h *host.Host) error {
+	out, err := h.RunSSHCommand("docker ps --format '{{.Names}}'")
+	if err != nil {
+		return err
+	}
+
+	if missing := missingContainers(n.expectedContainers(), strings.Fields(out)); len(missing) > 0 {
+		return fmt.Errorf("Containers not running: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// checkSwarmMode check the node is part of the Swarm mode cluster with the right role, and is ready for the manager
+func (n *Node) checkSwarmMode(h *host.Host, managerNodes map[string]string) CheckResult {
+	state, isManager, err := swarm.GetSwarmModeNodeState(h)
+	if err != nil {
+		return checkResult(err)
+	}
+
+	if state != "active" {
+		return checkResult(fmt.Errorf("Swarm mode state is '%s'", state))
+	}
+
+	if isManager != n.isSwarmMaster() {
+		return checkResult(fmt.Errorf("Wrong Swarm mode role (manager: %t)", isManager))
+	}
+
+	// the nodes status is only known if a manager is reachable
+	if managerNodes == nil {
+		return CheckResult{Status: CheckSkip, Message: "No Swarm mode manager reachable"}
+	}
+
+	nodeID, err := swarm.GetSwarmModeNodeID(h)
+	if err != nil {
+		return checkResult(err)
+	}
+
+	if status := managerNodes[nodeID]; status != "Ready" {
+		return checkResult(fmt.Errorf("Node status is '%s' for the managers", status))
+	}
+
+	return checkResult(nil)
+}
+
+// checkSwarmStandalone check the node is part of the Swarm standalone cluster and is healthy for the master
+func (n *Node) checkSwarmStandalone(masterNodes map[string]string) CheckResult {
+	// the nodes status is only known if a master is reachable
+	if masterNodes == nil {
+		return CheckResult{Status: CheckSkip, Message: "No Swarm standalone master reachable"}
+	}
+
+	// the node is listed by its engine hostname and its address
+	for _, k := range []string{n.NodeName, strings.Split(n.NodeName, ".")[0], n.clusterConfig.HostsLookupTable[n.MachineName]} {
+		if status, ok := masterNodes[k]; ok {
+			if status != "Healthy" {
+				return checkResult(fmt.Errorf("Node status is '%s' for the master", status))
+			}
+
+			return checkResult(nil)
+		}
+	}
+
+	return checkResult(fmt.Errorf("The node is not part of the Swarm standalone cluster"))
+}
+
+// checkNetwork check the node reach the other nodes of the cluster by their machine name
+func (n *Node) checkNetwork(h *host.Host) CheckResult {
+	others := []string{}
+	for machineName := range n.clusterConfig.HostsLookupTable {
+		if machineName != n.MachineName {
+			others = append(others, machineName)
+		}
+	}
+	sort.Strings(others)
+
+	if len(others) == 0 {
+		return CheckResult{Status: CheckSkip, Message: "No other node in the cluster"}
+	}
+
+	out, err := h.RunSSHCommand(fmt.Sprintf("for n in %s; do ping -c 1 -W 2 $n >/dev/null 2>&1 || echo $n; done", strings.Join(others, " ")))
+	if err != nil {
+		return checkResult(err)
+	}
+
+	if unreachable := strings.Fields(out); len(unreachable) > 0 {
+		return checkResult(fmt.Errorf("Unreachable nodes: %s", strings.Join(unreachable, ", ")))
+	}
+
+	return checkResult(nil)
+}
+
+// Check run the health checks of the node (swarmNodes are the nodes status seen by a Swarm mode manager or Swarm standalone master, nil if unknown)
+func (n *Node) Check(swarmNodes map[string]string) *NodeCheck {
+	nc := &NodeCheck{MachineName: n.MachineName, Results: make(map[string]CheckResult)}
+
+	// skip all the checks if the machine can't be loaded
+	h, err := n.clusterConfig.LibMachineClient.Load(n.MachineName)
+	if err != nil {
+		for _, name := range CheckNames {
+			nc.Results[name] = CheckResult{Status: CheckSkip, Message: fmt.Sprintf("Unable to load machine: %s", err)}
+		}
+		nc.Results[CheckEngine] = CheckResult{Status: CheckFail, Message: fmt.Sprintf("Unable to load machine: %s", err)}
+
+		return nc
+	}
+
+	// Docker Engine
+	_, err = h.RunSSHCommand("docker version --format '{{.Server.Version}}'")
+	nc.Results[CheckEngine] = checkResult(err)
+	engineUp := err == nil
+
+	// static lookup table and network
+	nc.Results[CheckHosts] = checkResult(hostsmapping.CheckClusterHostsMapping(h, n.clusterConfig.HostsLookupTable))
+	nc.Results[CheckNetwork] = n.checkNetwork(h)
+
+	// the Swarm and containers checks need the Docker Engine
+	if !engineUp {
+		nc.Results[CheckSwarm] = CheckResult{Status: CheckSkip, Message: "Docker Engine not responding"}
+		nc.Results[CheckContainers] = CheckResult{Status: CheckSkip, Message: "Docker Engine not responding"}
+		return nc
+	}
+
+	// Swarm membership
+	switch {
+	case n.clusterConfig.SwarmModeGlobalConfig != nil:
+		nc.Results[CheckSwarm] = n.checkSwarmMode(h, swarmNodes)
+	case n.clusterConfig.SwarmStandaloneGlobalConfig != nil:
+		nc.Results[CheckSwarm] = n.checkSwarmStandalone(swarmNodes)
+	default:
+		nc.Results[CheckSwarm] = CheckResult{Status: CheckSkip, Message: "Swarm not enabled"}
+	}
+
+	nc.Results[CheckContainers] = checkResult(n.checkContainers(h))
+
+	return nc
+}
+
+// swarmNodes returns the status of the Swarm nodes seen by the first reachable Swarm mode manager or Swarm standalone master, nil if none is reachable
+func (c *Cluster) swarmNodes() map[string]string {
+	if c.Config.SwarmModeGlobalConfig == nil && c.Config.SwarmStandaloneGlobalConfig == nil {
+		return nil
+	}
+
+	for _, k := range c.Config.SwarmMasterNode {
+		h, err := c.Config.LibMachineClient.Load(k)
+		if err != nil {
+			continue
+		}
+
+		listNodes := swarm.ListSwarmModeNodes
+		if c.Config.SwarmStandaloneGlobalConfig != nil {
+			listNodes = swarm.ListSwarmStandaloneNodes
+		}
+
+		if nodes, err := listNodes(h); err == nil {
+			return nodes
+		}
+	}
+
+	return nil
+}
+
+// CheckNodes run the health checks of all the provisionned nodes in parallel, and returns the results sorted by machine name
+func (c *Cluster) CheckNodes() []*NodeCheck {
+	swarmNodes := c.swarmNodes()
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	checks := []*NodeCheck{}
+
+	for _, n := range c.Nodes {
+		if !n.Provisioned {
+			continue
+		}
+
+		wg.Add(1)
+		go func(n *Node) {
+			defer wg.Done()
+
+			nc := n.Check(swarmNodes)
+
+			lock.Lock()
+			checks = append(checks, nc)
+			lock.Unlock()
+		}(n)
+	}
+
+	wg.Wait()
+
+	sort.Slice(checks, func(i, j int) bool { return checks[i].MachineName < checks[j].MachineName })
+
+	return checks
+}
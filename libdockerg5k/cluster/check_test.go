@@ -0,0 +1,64 @@
+package cluster
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
+)
+
+func TestMissingContainers(t *testing.T) {
+	assert.Equal(t, []string{"weavediscovery"}, missingContainers([]string{"swarm-agent", "weavediscovery"}, []string{"weave", "swarm-agent"}))
+	assert.Empty(t, missingContainers([]string{}, []string{"weave"}))
+}
+
+func TestExpectedContainersSwarmStandaloneMaster(t *testing.T) {
+	config := &GlobalConfig{
+		SwarmStandaloneGlobalConfig: &swarm.SwarmStandaloneGlobalConfig{},
+		SwarmMasterNode:             []string{"exp-lille-0"},
+		ClusterStore:                "etcd",
+		WeaveNetworkingEnabled:      true,
+	}
+
+	master := &Node{clusterConfig: config, MachineName: "exp-lille-0"}
+	assert.Equal(t, []string{"swarm-agent", "swarm-agent-master", "docker-g5k-etcd", "weave", "weavediscovery"}, master.expectedContainers())
+
+	worker := &Node{clusterConfig: config, MachineName: "exp-lille-1"}
+	assert.Equal(t, []string{"swarm-agent", "weave", "weavediscovery"}, worker.expectedContainers())
+}
+
+func TestExpectedContainersSwarmMode(t *testing.T) {
+	config := &GlobalConfig{SwarmModeGlobalConfig: &swarm.SwarmModeGlobalConfig{}, SwarmMasterNode: []string{"exp-lille-0"}}
+	assert.Empty(t, (&Node{clusterConfig: config, MachineName: "exp-lille-0"}).expectedContainers())
+}
+
+func TestNodeCheckFailed(t *testing.T) {
+	nc := &NodeCheck{MachineName: "exp-lille-0", Results: map[string]CheckResult{CheckEngine: {Status: CheckPass}, CheckSwarm: {Status: CheckSkip}}}
+	assert.False(t, nc.Failed())
+
+	nc.Results[CheckHosts] = CheckResult{Status: CheckFail, Message: "Missing or outdated entries: exp-lille-1"}
+	assert.True(t, nc.Failed())
+}
+
+func TestCheckSwarmStandalone(t *testing.T) {
+	config := &GlobalConfig{HostsLookupTable: map[string]string{"exp-lille-0": "172.16.37.1", "exp-lille-1": "172.16.37.2"}}
+	masterNodes := map[string]string{"chetemi-1": "Healthy", "172.16.37.2": "Pending"}
+
+	assert.Equal(t, CheckPass, (&Node{clusterConfig: config, MachineName: "exp-lille-0", NodeName: "chetemi-1.lille.grid5000.fr"}).checkSwarmStandalone(masterNodes).Status)
+	assert.Equal(t, CheckFail, (&Node{clusterConfig: config, MachineName: "exp-lille-1", NodeName: "chetemi-2.lille.grid5000.fr"}).checkSwarmStandalone(masterNodes).Status)
+	assert.Equal(t, CheckFail, (&Node{clusterConfig: config, MachineName: "exp-lille-2", NodeName: "chetemi-3.lille.grid5000.fr"}).checkSwarmStandalone(masterNodes).Status)
+
+	// the nodes status is unknown without a reachable master
+	r := (&Node{clusterConfig: config, MachineName: "exp-lille-0", NodeName: "chetemi-1.lille.grid5000.fr"}).checkSwarmStandalone(nil)
+	assert.Equal(t, CheckSkip, r.Status)
+	assert.Equal(t, "No Swarm standalone master reachable", r.Message)
+}
+
+func TestCheckNetworkNoOtherNode(t *testing.T) {
+	config := &GlobalConfig{HostsLookupTable: map[string]string{"exp-lille-0": "172.16.37.1"}}
+
+	// there is no other node to ping (the host is not used)
+	r := (&Node{clusterConfig: config, MachineName: "exp-lille-0"}).checkNetwork(nil)
+	assert.Equal(t, CheckSkip, r.Status)
+}
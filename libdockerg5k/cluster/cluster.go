@@ -2,21 +2,29 @@ package cluster
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"net"
 
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/hostsmapping"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/kvstore"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/retry"
 	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
-	"github.com/Spirals-Team/docker-g5k/libdockerg5k/zookeeper"
 	"github.com/docker/machine/libmachine"
+	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/log"
 	"github.com/docker/machine/libmachine/ssh"
 )
 
 // GlobalConfig contains the cluster global configuration
 type GlobalConfig struct {
-	// Docker Machine
-	LibMachineClient *libmachine.Client
+	// Docker Machine (not stored in the cluster state)
+	LibMachineClient *libmachine.Client `json:"-"`
 
 	// Docker Engine
 	EngineInstallURL string
@@ -28,6 +36,9 @@ type GlobalConfig struct {
 	G5kWalltime string
 	SSHKeyPair  *ssh.KeyPair
 
+	// Grid'5000 resources selection
+	G5kResourceProperties string
+
 	// Associates nodes IP address with Machine name
 	HostsLookupTable map[string]string
 
@@ -39,8 +50,18 @@ type GlobalConfig struct {
 	// Weave networking
 	WeaveNetworkingEnabled bool
 
-	// Cluster storage
-	UseZookeeperClusterStorage bool
+	// Cluster storage deployed on the Swarm master nodes (empty if not deployed)
+	ClusterStore string
+
+	// Retry policy of the nodes provisionning phases (not stored in the cluster state)
+	ProvisionRetryPolicy retry.Policy `json:"-"`
+
+	// Cluster lifecycle events (not stored in the cluster state, discarded if nil)
+	Events *events.Emitter `json:"-"`
+
+	// Maximum number of nodes provisionned at the same time in the cluster and by site, 0 for unlimited (not stored in the cluster state)
+	ProvisionParallelism     int `json:"-"`
+	ProvisionSiteParallelism int `json:"-"`
 }
 
 // GenerateSSHKeyPair generate a new global SSH key
@@ -54,97 +75,512 @@ func (c *GlobalConfig) GenerateSSHKeyPair() error {
 	return nil
 }
 
+// clusterStoreReadyTimeout is the maximum time to wait for the cluster storage to be ready
+const clusterStoreReadyTimeout = 5 * time.Minute
+
+// JobPhase represents the last completed phase of the cluster creation for a job
+type JobPhase string
+
+const (
+	// JobPhaseNone means the job is not submitted yet
+	JobPhaseNone JobPhase = ""
+	// JobPhaseSubmitted means the job is submitted but may not be ready yet
+	JobPhaseSubmitted JobPhase = "submitted"
+	// JobPhaseReserved means the job is ready
+	JobPhaseReserved JobPhase = "reserved"
+	// JobPhaseDeployed means the nodes of the job are deployed
+	JobPhaseDeployed JobPhase = "deployed"
+	// JobPhaseAllocated means the deployed nodes are allocated to the machines
+	JobPhaseAllocated JobPhase = "allocated"
+	// JobPhaseProvisioned means all the machines of the job are provisioned
+	JobPhaseProvisioned JobPhase = "provisioned"
+)
+
+// Job contains the informations of a Grid'5000 job reserved for the cluster
+type Job struct {
+	Site    string
+	ID      int
+	NbNodes int
+
+	// start date of the advance reservation (empty if the job starts as soon as possible)
+	Reservation string
+
+	// cluster creation progress
+	Phase         JobPhase
+	DeployedNodes []string
+}
+
 // Cluster represents the cluster
 type Cluster struct {
+	Name   string
 	Config *GlobalConfig
 	Nodes  map[string]*Node
+	Jobs   []*Job
+
+	// serialize the cluster state file writes
+	stateLock sync.Mutex
 }
 
-// NewCluster create a new cluster using the given configuration
-func NewCluster(config *GlobalConfig) *Cluster {
+// NewCluster create a new cluster using the given name and configuration
+func NewCluster(name string, config *GlobalConfig) *Cluster {
 	return &Cluster{
+		Name:   name,
 		Config: config,
 		Nodes:  make(map[string]*Node),
+		Jobs:   []*Job{},
+	}
+}
+
+// AddJob add a Grid'5000 job (not submitted yet) to the cluster and returns it
+func (c *Cluster) AddJob(site string, nbNodes int) *Job {
+	j := &Job{
+		Site:    site,
+		NbNodes: nbNodes,
+		Phase:   JobPhaseNone,
+	}
+
+	c.Jobs = append(c.Jobs, j)
+	return j
+}
+
+// UpdateJob apply the given changes to a job and save the cluster state (jobs are updated in parallel)
+func (c *Cluster) UpdateJob(j *Job, update func(j *Job)) error {
+	c.stateLock.Lock()
+	update(j)
+	c.stateLock.Unlock()
+
+	return c.Save()
+}
+
+// SetJobPhase set the phase of a job and save the cluster state
+func (c *Cluster) SetJobPhase(j *Job, phase JobPhase) error {
+	return c.UpdateJob(j, func(j *Job) {
+		j.Phase = phase
+	})
+}
+
+// ResetJob reset a job to its initial phase and release its nodes (the job must be killed before)
+func (c *Cluster) ResetJob(j *Job) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	// the Swarm cluster must be initialized again if a master/manager node of the job was provisioned
+	for _, k := range c.Config.SwarmMasterNode {
+		if n, ok := c.Nodes[k]; ok && n.G5kJobID == j.ID && n.NodeName != "" {
+			c.resetSwarmConfig()
+			break
+		}
+	}
+
+	// release the nodes allocated to the job
+	for machineName, n := range c.Nodes {
+		if n.G5kJobID == j.ID {
+			n.NodeName = ""
+			n.G5kJobID = 0
+			n.Provisioned = false
+			delete(c.Config.HostsLookupTable, machineName)
+		}
+	}
+
+	j.ID = 0
+	j.Reservation = ""
+	j.Phase = JobPhaseNone
+	j.DeployedNodes = nil
+}
+
+// resetSwarmConfig clear the Swarm mode join tokens and the Swarm standalone discovery generated from the master nodes address (the state lock must be held)
+func (c *Cluster) resetSwarmConfig() {
+	if c.Config.SwarmModeGlobalConfig != nil {
+		c.Config.SwarmModeGlobalConfig.ManagerToken = ""
+		c.Config.SwarmModeGlobalConfig.WorkerToken = ""
+		c.Config.SwarmModeGlobalConfig.BootstrapManagerURL = ""
+	}
+
+	// the discovery provided by the user is kept
+	if c.Config.SwarmStandaloneGlobalConfig != nil && c.Config.ClusterStore != "" {
+		if store, err := kvstore.Get(c.Config.ClusterStore); err == nil && c.Config.SwarmStandaloneGlobalConfig.Discovery == store.GenerateURL(c.Config.SwarmMasterNode, c.Config.HostsLookupTable) {
+			c.Config.SwarmStandaloneGlobalConfig.Discovery = ""
+		}
+	}
+}
+
+// ResetNode reset a node to its allocated phase, it will be provisionned again (the machine must be removed before)
+func (c *Cluster) ResetNode(n *Node) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	n.Provisioned = false
+	n.phase = ""
+
+	// the job of the node has no longer all its nodes provisionned
+	for _, j := range c.Jobs {
+		if j.ID == n.G5kJobID && j.Phase == JobPhaseProvisioned {
+			j.Phase = JobPhaseAllocated
+		}
+	}
+}
+
+// setNodeProvisioned mark the node as provisioned and save the cluster state
+func (c *Cluster) setNodeProvisioned(n *Node) error {
+	c.stateLock.Lock()
+	n.Provisioned = true
+	c.stateLock.Unlock()
+
+	return c.Save()
+}
+
+// updateJobsPhase set the 'provisioned' phase to the allocated jobs having all their nodes provisioned
+func (c *Cluster) updateJobsPhase() {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	for _, j := range c.Jobs {
+		if j.Phase != JobPhaseAllocated {
+			continue
+		}
+
+		provisioned := true
+		for _, n := range c.Nodes {
+			if n.G5kJobID == j.ID && !n.Provisioned {
+				provisioned = false
+			}
+		}
+
+		if provisioned {
+			j.Phase = JobPhaseProvisioned
+		}
 	}
 }
 
+// GetMachineName returns the Docker Machine name of a node of the cluster from its name ({site}-{id})
+func (c *Cluster) GetMachineName(nodeName string) string {
+	return fmt.Sprintf("%s-%s", c.Name, nodeName)
+}
+
+// getNodeID returns the ID of a node in its site (from its machine name : {cluster}-{site}-{id}), or -1 if invalid
+func (c *Cluster) getNodeID(n *Node) int {
+	id, err := strconv.Atoi(strings.TrimPrefix(n.MachineName, c.GetMachineName(n.G5kSite+"-")))
+	if err != nil {
+		return -1
+	}
+
+	return id
+}
+
+// AddNodes add nodes to a site of the cluster (using the next free IDs of the site) and returns their machine names
+func (c *Cluster) AddNodes(site string, count int) []string {
+	// get the next free ID of the site
+	nextID := 0
+	for _, n := range c.Nodes {
+		if id := c.getNodeID(n); n.G5kSite == site && id >= nextID {
+			nextID = id + 1
+		}
+	}
+
+	machineNames := []string{}
+	for i := nextID; i < nextID+count; i++ {
+		// generate machine name : {cluster}-{site}-{id}
+		machineName := c.GetMachineName(fmt.Sprintf("%s-%d", site, i))
+
+		// store node configuration
+		c.Nodes[machineName] = &Node{
+			clusterConfig: c.Config,
+			MachineName:   machineName,
+			G5kSite:       site,
+		}
+
+		machineNames = append(machineNames, machineName)
+	}
+
+	return machineNames
+}
+
 // CreateNodes creates nodes from reservations
 func (c *Cluster) CreateNodes(reservations map[string]int) {
 	for site, count := range reservations {
-		for i := 0; i < count; i++ {
-			// generate machine name : {site}-{id}
-			machineName := fmt.Sprintf("%s-%d", site, i)
-
-			// store node configuration
-			c.Nodes[machineName] = &Node{
-				clusterConfig: c.Config,
-				MachineName:   machineName,
-				G5kSite:       site,
-			}
-		}
+		c.AddNodes(site, count)
 	}
 }
 
 // AllocateDeployedNodesToMachines allocate the deployed nodes to the Docker Machines
 func (c *Cluster) AllocateDeployedNodesToMachines(site string, jobID int, deployedNodes []string) error {
-	// create configuration for deployed nodes
+	// lookup IP address of the nodes for static lookup table
+	nodesIP := make([]string, len(deployedNodes))
 	for i, n := range deployedNodes {
-		// generate machine name : {site}-{id}
-		machineName := fmt.Sprintf("%s-%d", site, i)
-
-		// set driver parameters
-		c.Nodes[machineName].NodeName = n
-		c.Nodes[machineName].G5kJobID = jobID
-
-		// lookup IP address of the node for static lookup table
 		ip, err := net.LookupIP(n)
 		if err != nil || len(ip) < 1 {
 			return fmt.Errorf("Unable to lookup IP address for '%s' node: '%s'", n, err)
 		}
 
+		nodesIP[i] = ip[0].String()
+	}
+
+	// sites are allocated in parallel
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	// get the machines of the site not allocated yet (sorted by ID)
+	nodes := []*Node{}
+	for _, n := range c.Nodes {
+		if n.G5kSite == site && n.NodeName == "" {
+			nodes = append(nodes, n)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return c.getNodeID(nodes[i]) < c.getNodeID(nodes[j]) })
+
+	if len(nodes) < len(deployedNodes) {
+		return fmt.Errorf("Not enough machines for the %d deployed nodes of site '%s'", len(deployedNodes), site)
+	}
+
+	// create configuration for deployed nodes
+	for i, n := range deployedNodes {
+		// set driver parameters
+		nodes[i].NodeName = n
+		nodes[i].G5kJobID = jobID
+
 		// set IP address of the machine in the static lookup table
-		c.Config.HostsLookupTable[machineName] = ip[0].String()
+		c.Config.HostsLookupTable[nodes[i].MachineName] = nodesIP[i]
 	}
 
 	return nil
 }
 
-// ProvisionNodes provision the nodes in the cluster (in parallel)
-func (c *Cluster) ProvisionNodes() error {
-	// if Swarm standalone is enabled, and no discovery method provided, deploy a Zookeeper instance for the cluster
-	if (c.Config.SwarmStandaloneGlobalConfig != nil) && (c.Config.SwarmStandaloneGlobalConfig.Discovery == "") {
-		log.Info("No Swarm cluster storage defined, Zookeeper will be deployed on each master nodes")
+// RemoveJob removes a job and its nodes from the cluster
+func (c *Cluster) RemoveJob(jobID int) {
+	// remove the job
+	jobs := []*Job{}
+	for _, j := range c.Jobs {
+		if j.ID != jobID {
+			jobs = append(jobs, j)
+		}
+	}
+	c.Jobs = jobs
+
+	// remove the nodes allocated to the job
+	for machineName, n := range c.Nodes {
+		if n.G5kJobID == jobID {
+			delete(c.Nodes, machineName)
+			delete(c.Config.HostsLookupTable, machineName)
+		}
+	}
+}
+
+// DropJob removes a job from the cluster without its nodes (the nodes of the job must be removed before)
+func (c *Cluster) DropJob(j *Job) {
+	jobs := []*Job{}
+	for _, cj := range c.Jobs {
+		if cj != j {
+			jobs = append(jobs, cj)
+		}
+	}
+	c.Jobs = jobs
+}
+
+// waitForClusterStore wait until the cluster storage running on the Swarm master nodes can serve requests
+func (c *Cluster) waitForClusterStore(store kvstore.KVStore) error {
+	hosts := []*host.Host{}
+	for _, k := range c.Config.SwarmMasterNode {
+		h, err := c.Config.LibMachineClient.Load(k)
+		if err != nil {
+			return err
+		}
+
+		hosts = append(hosts, h)
+	}
+
+	log.Infof("Waiting for the %s cluster storage to be ready...", c.Config.ClusterStore)
+	return store.WaitUntilReady(hosts, clusterStoreReadyTimeout)
+}
+
+// semaphore limits the number of goroutines running at the same time (unlimited if nil)
+type semaphore chan struct{}
+
+// newSemaphore returns a semaphore allowing n goroutines at the same time, unlimited if n <= 0
+func newSemaphore(n int) semaphore {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(semaphore, n)
+}
+
+// acquire wait for a free slot
+func (s semaphore) acquire() {
+	if s != nil {
+		s <- struct{}{}
+	}
+}
+
+// release free a slot
+func (s semaphore) release() {
+	if s != nil {
+		<-s
+	}
+}
+
+// NodeResult is the result of the provisionning of a node
+type NodeResult struct {
+	NodeName    string
+	MachineName string
+	Phase       NodePhase
+	Err         error
+}
+
+// Failed returns true if the node is not provisioned (the nodes of the skipped sites are not failed)
+func (r NodeResult) Failed() bool {
+	return r.Phase != NodePhaseProvisioned && r.Phase != NodePhaseSkipped
+}
+
+// Skipped returns true if the site of the node failed and was skipped
+func (r NodeResult) Skipped() bool {
+	return r.Phase == NodePhaseSkipped
+}
+
+// nodesResults returns the provisionning result of all the nodes of the cluster, sorted by machine name
+func (c *Cluster) nodesResults(errs map[string]error) []NodeResult {
+	machineNames := []string{}
+	for k := range c.Nodes {
+		machineNames = append(machineNames, k)
+	}
+	sort.Strings(machineNames)
+
+	// sites having a job not allocated failed before the provisionning
+	skippedSites := make(map[string]bool)
+	for _, j := range c.Jobs {
+		if j.Phase != JobPhaseAllocated && j.Phase != JobPhaseProvisioned {
+			skippedSites[j.Site] = true
+		}
+	}
+
+	results := []NodeResult{}
+	for _, k := range machineNames {
+		n := c.Nodes[k]
+		r := NodeResult{NodeName: n.NodeName, MachineName: n.MachineName, Phase: n.Phase(), Err: errs[n.MachineName]}
+
+		// nodes of failed sites are not provisioned
+		if r.Phase == NodePhaseNotDeployed && r.Err == nil {
+			if skippedSites[n.G5kSite] {
+				r.Phase = NodePhaseSkipped
+			} else {
+				r.Err = fmt.Errorf("No deployed node allocated")
+			}
+		}
+
+		results = append(results, r)
+	}
+
+	return results
+}
+
+// ProvisionNodes provision the nodes in the cluster (in parallel) and returns the result of each node
+// An error is returned only if the Swarm master/manager nodes or the cluster storage can't be provisioned
+func (c *Cluster) ProvisionNodes() ([]NodeResult, error) {
+	// provisionning errors by machine name
+	errs := make(map[string]error)
+
+	// if Swarm standalone is enabled, and no discovery method provided, deploy a cluster storage on the master nodes (Zookeeper by default)
+	if (c.Config.SwarmStandaloneGlobalConfig != nil) && (c.Config.SwarmStandaloneGlobalConfig.Discovery == "") && (c.Config.ClusterStore == "") {
+		c.Config.ClusterStore = "zookeeper"
+	}
 
-		// enable Zookeeper
-		c.Config.UseZookeeperClusterStorage = true
+	var store kvstore.KVStore
+	if c.Config.ClusterStore != "" {
+		s, err := kvstore.Get(c.Config.ClusterStore)
+		if err != nil {
+			return nil, err
+		}
+		store = s
 
-		// set discovery string with zookeeper url
-		c.Config.SwarmStandaloneGlobalConfig.Discovery = zookeeper.GenerateClusterStorageURL(c.Config.SwarmMasterNode, c.Config.HostsLookupTable)
+		// set discovery string with the cluster storage url
+		if c.Config.SwarmStandaloneGlobalConfig.Discovery == "" {
+			log.Infof("No Swarm cluster storage defined, %s will be deployed on each master nodes", c.Config.ClusterStore)
+			c.Config.SwarmStandaloneGlobalConfig.Discovery = store.GenerateURL(c.Config.SwarmMasterNode, c.Config.HostsLookupTable)
+		}
 	}
 
 	// provision Swarm master/manager nodes (sequential)
 	for _, k := range c.Config.SwarmMasterNode {
+		// skip nodes already provisionned (resumed cluster creation)
+		if c.Nodes[k].Provisioned {
+			continue
+		}
+
+		// Swarm master/manager nodes are mandatory
+		if c.Nodes[k].NodeName == "" {
+			return c.nodesResults(errs), fmt.Errorf("The Swarm master/manager node '%s' is not deployed", c.Nodes[k].MachineName)
+		}
+
 		log.Infof("Provisionning Swarm master/manager node '%s' ('%s')...", c.Nodes[k].NodeName, c.Nodes[k].MachineName)
 
 		// error in Swarm master provisionning is fatal
 		if err := c.Nodes[k].Provision(); err != nil {
-			return fmt.Errorf("Error while provisionning Swarm master/manager node '%s' ('%s'): '%s'", c.Nodes[k].NodeName, c.Nodes[k].MachineName, err)
+			errs[k] = err
+			c.Nodes[k].emit(events.NodeFailed, err.Error())
+			return c.nodesResults(errs), fmt.Errorf("Error while provisionning Swarm master/manager node '%s' ('%s'): '%s'", c.Nodes[k].NodeName, c.Nodes[k].MachineName, err)
 		}
+
+		if err := c.setNodeProvisioned(c.Nodes[k]); err != nil {
+			return c.nodesResults(errs), err
+		}
+		c.Nodes[k].emit(events.NodeProvisioned, "")
+	}
+
+	// the workers need the cluster storage to join the Swarm standalone cluster
+	if store != nil {
+		if err := c.waitForClusterStore(store); err != nil {
+			return c.nodesResults(errs), err
+		}
+	}
+
+	// save the cluster state (Swarm mode join tokens are now available)
+	if err := c.Save(); err != nil {
+		return c.nodesResults(errs), err
 	}
 
 	log.Info("Provisionning nodes, it will take a few minutes...")
 
+	// limit the number of nodes provisionned at the same time (globally and by site)
+	clusterSem := newSemaphore(c.Config.ProvisionParallelism)
+	sitesSem := make(map[string]semaphore)
+	for _, n := range c.Nodes {
+		if _, ok := sitesSem[n.G5kSite]; !ok {
+			sitesSem[n.G5kSite] = newSemaphore(c.Config.ProvisionSiteParallelism)
+		}
+	}
+
 	// provision all deployed nodes (parallel)
 	var wg sync.WaitGroup
+	var errsLock sync.Mutex
 	for _, n := range c.Nodes {
-		// skip already provisionned Swarm master/manager
-		if !n.isSwarmMaster() {
+		// skip already provisionned Swarm master/manager and nodes (resumed cluster creation), and nodes of failed sites
+		if !n.isSwarmMaster() && !n.Provisioned && n.NodeName != "" {
 			wg.Add(1)
 			go func(n *Node) {
 				defer wg.Done()
-				if err := n.Provision(); err != nil {
+
+				// wait for a free slot on the site, then in the cluster
+				sitesSem[n.G5kSite].acquire()
+				defer sitesSem[n.G5kSite].release()
+				clusterSem.acquire()
+				defer clusterSem.release()
+
+				err := n.Provision()
+				if err != nil {
 					log.Errorf("Error while provisionning node '%s' ('%s'): '%s'\n", n.NodeName, n.MachineName, err)
+				} else if err = c.setNodeProvisioned(n); err != nil {
+					log.Errorf("Error while saving the state of node '%s' ('%s'): '%s'\n", n.NodeName, n.MachineName, err)
 				}
+
+				if err != nil {
+					errsLock.Lock()
+					errs[n.MachineName] = err
+					errsLock.Unlock()
+
+					n.emit(events.NodeFailed, err.Error())
+					return
+				}
+
+				n.emit(events.NodeProvisioned, "")
 			}(n)
 		}
 	}
@@ -152,5 +588,36 @@ func (c *Cluster) ProvisionNodes() error {
 	// wait nodes provisionning to finish
 	wg.Wait()
 
+	// update the jobs having all their nodes provisionned
+	c.updateJobsPhase()
+
+	return c.nodesResults(errs), c.Save()
+}
+
+// UpdateNodesHostsMapping replace the cluster entries in the static lookup table of all the provisionned nodes
+func (c *Cluster) UpdateNodesHostsMapping() error {
+	failedNodes := []string{}
+	for _, n := range c.Nodes {
+		if !n.Provisioned {
+			continue
+		}
+
+		h, err := c.Config.LibMachineClient.Load(n.MachineName)
+		if err != nil {
+			log.Errorf("Unable to load machine '%s': '%s'", n.MachineName, err)
+			failedNodes = append(failedNodes, n.MachineName)
+			continue
+		}
+
+		if err := hostsmapping.UpdateClusterHostsMapping(h, c.Config.HostsLookupTable); err != nil {
+			log.Errorf("Unable to update the static lookup table of machine '%s': '%s'", n.MachineName, err)
+			failedNodes = append(failedNodes, n.MachineName)
+		}
+	}
+
+	if len(failedNodes) > 0 {
+		return fmt.Errorf("Unable to update the static lookup table of %d node(s): %s", len(failedNodes), strings.Join(failedNodes, ", "))
+	}
+
 	return nil
 }
@@ -0,0 +1,144 @@
+package cluster
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddNodesEmptySite(t *testing.T) {
+	c := NewCluster("test", &GlobalConfig{})
+	names := c.AddNodes("lille", 2)
+	assert.Equal(t, []string{"test-lille-0", "test-lille-1"}, names)
+	assert.Equal(t, 1, c.getNodeID(c.Nodes["test-lille-1"]))
+}
+
+func TestAddNodesNextFreeID(t *testing.T) {
+	c := NewCluster("test", &GlobalConfig{})
+	c.CreateNodes(map[string]int{"lille": 16, "nantes": 2})
+	names := c.AddNodes("lille", 2)
+	assert.Equal(t, []string{"test-lille-16", "test-lille-17"}, names)
+	assert.Equal(t, 20, len(c.Nodes))
+}
+
+func TestSemaphoreLimit(t *testing.T) {
+	s := newSemaphore(2)
+	s.acquire()
+	s.acquire()
+
+	acquired := make(chan bool)
+	go func() {
+		s.acquire()
+		acquired <- true
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("the semaphore allowed more goroutines than its limit")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.release()
+	<-acquired
+}
+
+func TestSemaphoreUnlimited(t *testing.T) {
+	s := newSemaphore(0)
+	for i := 0; i < 100; i++ {
+		s.acquire()
+	}
+	assert.Nil(t, s)
+}
+
+func TestNodesResultsSkippedSite(t *testing.T) {
+	c := NewCluster("test", &GlobalConfig{})
+	c.CreateNodes(map[string]int{"lille": 1, "nantes": 2})
+	c.AddJob("lille", 1).Phase = JobPhaseProvisioned
+	c.AddJob("nantes", 2).Phase = JobPhaseSubmitted
+	c.Nodes["test-lille-0"].NodeName = "chetemi-1.lille.grid5000.fr"
+	c.Nodes["test-lille-0"].Provisioned = true
+
+	results := c.nodesResults(map[string]error{})
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, NodePhaseProvisioned, results[0].Phase)
+	for _, r := range results[1:] {
+		assert.Equal(t, NodePhaseSkipped, r.Phase)
+		assert.True(t, r.Skipped())
+		assert.False(t, r.Failed())
+		assert.NoError(t, r.Err)
+	}
+}
+
+func TestNodesResultsNotAllocated(t *testing.T) {
+	c := NewCluster("test", &GlobalConfig{})
+	c.CreateNodes(map[string]int{"lille": 2})
+	c.AddJob("lille", 2).Phase = JobPhaseAllocated
+	c.Nodes["test-lille-0"].NodeName = "chetemi-1.lille.grid5000.fr"
+
+	results := c.nodesResults(map[string]error{})
+	assert.Equal(t, NodePhaseNotDeployed, results[1].Phase)
+	assert.True(t, results[1].Failed())
+	assert.Error(t, results[1].Err)
+}
+
+func TestResetJobSwarmModeMaster(t *testing.T) {
+	c := NewCluster("test", &GlobalConfig{
+		HostsLookupTable:      map[string]string{"test-lille-0": "172.16.0.1"},
+		SwarmModeGlobalConfig: &swarm.SwarmModeGlobalConfig{ManagerToken: "mgr", WorkerToken: "wkr", BootstrapManagerURL: "172.16.0.1:2377"},
+		SwarmMasterNode:       []string{"test-lille-0"},
+	})
+	c.CreateNodes(map[string]int{"lille": 1})
+	j := c.AddJob("lille", 1)
+	j.ID = 42
+	c.Nodes["test-lille-0"].NodeName = "chetemi-1.lille.grid5000.fr"
+	c.Nodes["test-lille-0"].G5kJobID = 42
+
+	c.ResetJob(j)
+	assert.False(t, c.Config.SwarmModeGlobalConfig.IsSwarmModeClusterInitialized())
+	assert.Equal(t, "", c.Config.SwarmModeGlobalConfig.BootstrapManagerURL)
+	assert.Equal(t, "", c.Nodes["test-lille-0"].NodeName)
+}
+
+func TestResetJobSwarmStandaloneMaster(t *testing.T) {
+	c := NewCluster("test", &GlobalConfig{
+		HostsLookupTable:            map[string]string{"test-lille-0": "172.16.0.1"},
+		SwarmStandaloneGlobalConfig: &swarm.SwarmStandaloneGlobalConfig{Discovery: "zk://172.16.0.1"},
+		SwarmMasterNode:             []string{"test-lille-0"},
+		ClusterStore:                "zookeeper",
+	})
+	c.CreateNodes(map[string]int{"lille": 1, "nantes": 1})
+	lille := c.AddJob("lille", 1)
+	lille.ID = 42
+	nantes := c.AddJob("nantes", 1)
+	nantes.ID = 43
+	c.Nodes["test-lille-0"].NodeName = "chetemi-1.lille.grid5000.fr"
+	c.Nodes["test-lille-0"].G5kJobID = 42
+	c.Nodes["test-nantes-0"].NodeName = "ecotype-1.nantes.grid5000.fr"
+	c.Nodes["test-nantes-0"].G5kJobID = 43
+
+	// the job of a worker node does not change the discovery
+	c.ResetJob(nantes)
+	assert.Equal(t, "zk://172.16.0.1", c.Config.SwarmStandaloneGlobalConfig.Discovery)
+
+	// the discovery generated from the master nodes address is cleared
+	c.ResetJob(lille)
+	assert.Equal(t, "", c.Config.SwarmStandaloneGlobalConfig.Discovery)
+}
+
+func TestResetJobSwarmStandaloneUserDiscovery(t *testing.T) {
+	c := NewCluster("test", &GlobalConfig{
+		HostsLookupTable:            map[string]string{"test-lille-0": "172.16.0.1"},
+		SwarmStandaloneGlobalConfig: &swarm.SwarmStandaloneGlobalConfig{Discovery: "consul://consul.example.com:8500"},
+		SwarmMasterNode:             []string{"test-lille-0"},
+	})
+	c.CreateNodes(map[string]int{"lille": 1})
+	j := c.AddJob("lille", 1)
+	j.ID = 42
+	c.Nodes["test-lille-0"].NodeName = "chetemi-1.lille.grid5000.fr"
+	c.Nodes["test-lille-0"].G5kJobID = 42
+
+	c.ResetJob(j)
+	assert.Equal(t, "consul://consul.example.com:8500", c.Config.SwarmStandaloneGlobalConfig.Discovery)
+}
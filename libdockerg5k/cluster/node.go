@@ -5,17 +5,39 @@ import (
 	"fmt"
 	"path/filepath"
 
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
 	"github.com/Spirals-Team/docker-g5k/libdockerg5k/hostsmapping"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/kvstore"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
 	"github.com/Spirals-Team/docker-g5k/libdockerg5k/weave"
-	"github.com/Spirals-Team/docker-g5k/libdockerg5k/zookeeper"
 	g5kdriver "github.com/Spirals-Team/docker-machine-driver-g5k/driver"
 	"github.com/docker/machine/commands/mcndirs"
 	"github.com/docker/machine/libmachine/auth"
+	"github.com/docker/machine/libmachine/host"
+)
+
+// NodePhase represents the last completed phase of the provisionning of a node
+type NodePhase string
+
+const (
+	// NodePhaseNotDeployed means no deployed node is allocated to the machine
+	NodePhaseNotDeployed NodePhase = "not deployed"
+	// NodePhaseDeployed means a deployed node is allocated to the machine
+	NodePhaseDeployed NodePhase = "deployed"
+	// NodePhaseMachineCreated means the machine is created and the Docker Engine is installed
+	NodePhaseMachineCreated NodePhase = "machine created"
+	// NodePhaseConfigured means the hosts lookup table, cluster storage and networking are configured
+	NodePhaseConfigured NodePhase = "configured"
+	// NodePhaseProvisioned means the node joined the Swarm cluster (if enabled)
+	NodePhaseProvisioned NodePhase = "provisioned"
+	// NodePhaseSkipped means the site of the machine failed and was skipped by the current run
+	NodePhaseSkipped NodePhase = "skipped"
 )
 
 // Node contain node specific informations
 type Node struct {
 	clusterConfig *GlobalConfig
+	phase         NodePhase // last completed provisionning phase of the current run
 
 	NodeName    string // Grid'5000 node hostname
 	MachineName string // Docker Machine name
@@ -27,6 +49,9 @@ type Node struct {
 	// Docker Engine
 	EngineOpt   []string
 	EngineLabel []string
+
+	// cluster creation progress
+	Provisioned bool
 }
 
 // createHostAuthOptions returns a configured AuthOptions for HostOptions struct
@@ -44,6 +69,85 @@ func (n *Node) createHostAuthOptions() *auth.Options {
 	}
 }
 
+// removeFromStore remove the machine from the Docker Machine store if it exists (the job is not killed)
+func (n *Node) removeFromStore() error {
+	if exists, err := n.clusterConfig.LibMachineClient.Exists(n.MachineName); err == nil && exists {
+		if err := n.clusterConfig.LibMachineClient.Remove(n.MachineName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cleanupMachine remove the Swarm standalone containers started by a failed machine creation, and the machine from the store
+func (n *Node) cleanupMachine() error {
+	// the Docker Engine may not be installed, errors are ignored
+	if h, err := n.clusterConfig.LibMachineClient.Load(n.MachineName); err == nil {
+		h.RunSSHCommand("docker rm -f swarm-agent swarm-agent-master >/dev/null 2>&1 || true")
+	}
+
+	return n.removeFromStore()
+}
+
+// createMachine create a new host using the driver configuration and provision it (Docker Engine installation and configuration)
+func (n *Node) createMachine(driverData []byte, store kvstore.KVStore) (*host.Host, error) {
+	// create a new host config
+	h, err := n.clusterConfig.LibMachineClient.NewHost("g5k", driverData)
+	if err != nil {
+		return nil, err
+	}
+
+	// set Docker Engine parameters
+	h.HostOptions.EngineOptions.ArbitraryFlags = append([]string{}, n.EngineOpt...)
+	h.HostOptions.EngineOptions.Labels = n.EngineLabel
+	h.HostOptions.EngineOptions.InstallURL = n.clusterConfig.EngineInstallURL
+
+	// mandatory, or driver will use bad paths for certificates
+	h.HostOptions.AuthOptions = n.createHostAuthOptions()
+
+	// set swarm options if Swarm standalone is enabled
+	if n.clusterConfig.SwarmStandaloneGlobalConfig != nil {
+		h.HostOptions.SwarmOptions = n.clusterConfig.SwarmStandaloneGlobalConfig.CreateNodeConfig(n.NodeName, n.isSwarmMaster(), true)
+	}
+
+	// set 'cluster-advertise' & 'cluster-store' Docker Engine options
+	if store != nil {
+		h.HostOptions.EngineOptions.ArbitraryFlags = append(h.HostOptions.EngineOptions.ArbitraryFlags, store.EngineFlags(n.clusterConfig.SwarmStandaloneGlobalConfig.Discovery)...)
+	}
+
+	// provision the new machine
+	if err := n.clusterConfig.LibMachineClient.Create(h); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+// emit send a lifecycle event of the node
+func (n *Node) emit(t events.Type, message string) {
+	n.clusterConfig.Events.Emit(events.Event{Type: t, Site: n.G5kSite, JobID: n.G5kJobID, Machine: n.MachineName, Message: message})
+}
+
+// Phase returns the last completed provisionning phase of the node
+func (n *Node) Phase() NodePhase {
+	switch {
+	case n.Provisioned:
+		return NodePhaseProvisioned
+	case n.NodeName == "":
+		return NodePhaseNotDeployed
+	case n.phase != "":
+		return n.phase
+	default:
+		return NodePhaseDeployed
+	}
+}
+
+// IsCreatedByCurrentRun returns true if the machine of the node was created by the current provisionning run
+func (n *Node) IsCreatedByCurrentRun() bool {
+	return n.phase != ""
+}
+
 // isSwarmMaster returns true if this node is a Swarm master/manager, false otherwise
 func (n *Node) isSwarmMaster() bool {
 	for _, v := range n.clusterConfig.SwarmMasterNode {
@@ -86,75 +190,100 @@ func (n *Node) Provision() error {
 		return err
 	}
 
-	// create a new host config
-	h, err := n.clusterConfig.LibMachineClient.NewHost("g5k", data)
-	if err != nil {
-		return err
+	// Engine cluster storage
+	var store kvstore.KVStore
+	if n.clusterConfig.ClusterStore != "" {
+		store, err = kvstore.Get(n.clusterConfig.ClusterStore)
+		if err != nil {
+			return err
+		}
 	}
 
-	// set Docker Engine parameters
-	h.HostOptions.EngineOptions.ArbitraryFlags = n.EngineOpt
-	h.HostOptions.EngineOptions.Labels = n.EngineLabel
-	h.HostOptions.EngineOptions.InstallURL = n.clusterConfig.EngineInstallURL
-
-	// mandatory, or driver will use bad paths for certificates
-	h.HostOptions.AuthOptions = n.createHostAuthOptions()
-
-	// set swarm options if Swarm standalone is enabled
-	if n.clusterConfig.SwarmStandaloneGlobalConfig != nil {
-		h.HostOptions.SwarmOptions = n.clusterConfig.SwarmStandaloneGlobalConfig.CreateNodeConfig(n.NodeName, n.isSwarmMaster(), true)
+	// remove the machine left by a previous failed provisionning (only from the store, the job must not be killed)
+	if err := n.removeFromStore(); err != nil {
+		return err
 	}
 
-	// Engine cluster storage
-	if n.clusterConfig.UseZookeeperClusterStorage {
-		// set 'cluster-advertise' & 'cluster-store' Docker Engine options
-		h.HostOptions.EngineOptions.ArbitraryFlags = append(h.HostOptions.EngineOptions.ArbitraryFlags, "cluster-advertise=eth0:2379", fmt.Sprintf("cluster-store=%s", n.clusterConfig.SwarmStandaloneGlobalConfig.Discovery))
-	}
+	policy := n.clusterConfig.ProvisionRetryPolicy
 
-	// provision the new machine
-	if err := n.clusterConfig.LibMachineClient.Create(h); err != nil {
+	// create and provision the new machine
+	n.emit(events.NodeEngineInstall, "")
+	var h *host.Host
+	if err := policy.Do(fmt.Sprintf("Machine creation of '%s'", n.MachineName), func() error {
+		var err error
+		h, err = n.createMachine(data, store)
+		return err
+	}, n.cleanupMachine); err != nil {
 		return err
 	}
+	n.phase = NodePhaseMachineCreated
+	n.emit(events.NodeConfiguring, "")
 
 	// add all cluster nodes to the static lookup table of the host
-	if err := hostsmapping.AddClusterHostsMapping(h, n.clusterConfig.HostsLookupTable); err != nil {
+	if err := policy.Do(fmt.Sprintf("Hosts mapping of '%s'", n.MachineName), func() error {
+		return hostsmapping.AddClusterHostsMapping(h, n.clusterConfig.HostsLookupTable)
+	}, func() error {
+		return hostsmapping.RemoveClusterHostsMapping(h)
+	}); err != nil {
 		return err
 	}
 
 	// Swarm standalone (post-creation)
 	if n.clusterConfig.SwarmStandaloneGlobalConfig != nil {
-		// run Zookeeper cluster storage on Swarm master nodes only
-		if n.isSwarmMaster() && n.clusterConfig.UseZookeeperClusterStorage {
-			zookeeper.StartClusterStorage(h, n.clusterConfig.SwarmMasterNode)
+		// run the cluster storage on Swarm master nodes only (the previous container is removed when starting it)
+		if n.isSwarmMaster() && store != nil {
+			if err := policy.Do(fmt.Sprintf("Cluster storage start on '%s'", n.MachineName), func() error {
+				return store.Start(h, n.clusterConfig.SwarmMasterNode, n.clusterConfig.HostsLookupTable)
+			}, nil); err != nil {
+				return fmt.Errorf("Unable to start the %s cluster storage: '%s'", n.clusterConfig.ClusterStore, err)
+			}
 		}
 
 		// run Weave Net / Discovery if enabled
 		if n.clusterConfig.WeaveNetworkingEnabled {
 			// run Weave Net
-			if err := weave.RunWeaveNet(h); err != nil {
+			if err := policy.Do(fmt.Sprintf("Weave Net start on '%s'", n.MachineName), func() error {
+				return weave.RunWeaveNet(h)
+			}, func() error {
+				return weave.ResetWeaveNet(h)
+			}); err != nil {
 				return err
 			}
 
 			// run Weave Discovery
-			if err := weave.RunWeaveDiscovery(h, n.clusterConfig.SwarmStandaloneGlobalConfig.Discovery); err != nil {
+			if err := policy.Do(fmt.Sprintf("Weave Discovery start on '%s'", n.MachineName), func() error {
+				return weave.RunWeaveDiscovery(h, n.clusterConfig.SwarmStandaloneGlobalConfig.Discovery)
+			}, func() error {
+				return weave.RemoveWeaveDiscovery(h)
+			}); err != nil {
 				return err
 			}
 		}
 	}
 
+	n.phase = NodePhaseConfigured
+
 	// Swarm mode
 	if n.clusterConfig.SwarmModeGlobalConfig != nil {
-		// check if cluster is already initialized
-		if !n.clusterConfig.SwarmModeGlobalConfig.IsSwarmModeClusterInitialized() {
-			// initialize Swarm mode cluster (only for bootstrap node)
-			if err := n.clusterConfig.SwarmModeGlobalConfig.InitSwarmModeCluster(h); err != nil {
-				return err
+		n.emit(events.NodeSwarmJoin, "")
+		initialized := n.clusterConfig.SwarmModeGlobalConfig.IsSwarmModeClusterInitialized()
+		if err := policy.Do(fmt.Sprintf("Swarm mode join of '%s'", n.MachineName), func() error {
+			// check if cluster is already initialized
+			if !n.clusterConfig.SwarmModeGlobalConfig.IsSwarmModeClusterInitialized() {
+				// initialize Swarm mode cluster (only for bootstrap node)
+				return n.clusterConfig.SwarmModeGlobalConfig.InitSwarmModeCluster(h)
 			}
-		} else {
+
 			// join the Swarm mode cluster
-			if err := n.clusterConfig.SwarmModeGlobalConfig.JoinSwarmModeCluster(h, n.isSwarmMaster()); err != nil {
-				return err
-			}
+			return n.clusterConfig.SwarmModeGlobalConfig.JoinSwarmModeCluster(h, n.isSwarmMaster())
+		}, func() error {
+			return swarm.ForceLeaveSwarmMode(h)
+		}); err != nil {
+			return err
+		}
+
+		if !initialized {
+			n.emit(events.SwarmInitialized, fmt.Sprintf("bootstrap manager %s", n.clusterConfig.SwarmModeGlobalConfig.BootstrapManagerURL))
 		}
 	}
 
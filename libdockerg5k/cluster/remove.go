@@ -0,0 +1,98 @@
+package cluster
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
+	"github.com/docker/machine/libmachine/log"
+)
+
+// swarmDrainTimeout is the maximum time to wait for the tasks of a drained node to be rescheduled
+const swarmDrainTimeout = 5 * time.Minute
+
+// GetRemainingSwarmMaster returns a provisionned Swarm master/manager node not in the given nodes list
+func (c *Cluster) GetRemainingSwarmMaster(removedNodes map[string]bool) (*Node, error) {
+	for _, k := range c.Config.SwarmMasterNode {
+		if n, ok := c.Nodes[k]; ok && n.Provisioned && !removedNodes[k] {
+			return n, nil
+		}
+	}
+
+	return nil, fmt.Errorf("At least one Swarm master/manager node must remain in the cluster")
+}
+
+// DecommissionNode remove a node from the Swarm cluster (drained first in Swarm mode) and from the Docker Machine store
+// The master is a Swarm master/manager node staying in the cluster (only needed in Swarm mode)
+func (c *Cluster) DecommissionNode(n *Node, master *Node) error {
+	// nodes not provisionned are not in the Swarm cluster nor in the store
+	if !n.Provisioned {
+		return nil
+	}
+
+	h, err := c.Config.LibMachineClient.Load(n.MachineName)
+	if err != nil {
+		return err
+	}
+
+	// Swarm mode
+	if c.Config.SwarmModeGlobalConfig != nil {
+		manager, err := c.Config.LibMachineClient.Load(master.MachineName)
+		if err != nil {
+			return err
+		}
+
+		nodeID, err := swarm.GetSwarmModeNodeID(h)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Draining node '%s' ('%s')...", n.NodeName, n.MachineName)
+		if err := swarm.DrainSwarmModeNode(manager, nodeID, swarmDrainTimeout); err != nil {
+			return fmt.Errorf("Unable to drain the node: '%s'", err)
+		}
+
+		if err := swarm.LeaveSwarmModeCluster(manager, h, nodeID, n.isSwarmMaster()); err != nil {
+			return fmt.Errorf("Unable to remove the node from the Swarm mode cluster: '%s'", err)
+		}
+	}
+
+	// Swarm standalone
+	if c.Config.SwarmStandaloneGlobalConfig != nil {
+		if err := swarm.RemoveFromDiscovery(h); err != nil {
+			return err
+		}
+	}
+
+	// remove the machine from the store (the job is not killed)
+	return c.Config.LibMachineClient.Remove(n.MachineName)
+}
+
+// RemoveNode removes a node from the cluster configuration (and promote a new Swarm mode bootstrap manager if needed)
+func (c *Cluster) RemoveNode(machineName string) {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	// the Swarm mode join address of the node (if it is the bootstrap manager)
+	removedManagerURL := net.JoinHostPort(c.Config.HostsLookupTable[machineName], "2377")
+
+	delete(c.Nodes, machineName)
+	delete(c.Config.HostsLookupTable, machineName)
+
+	// remove the node from the Swarm master/manager nodes
+	masters := []string{}
+	for _, k := range c.Config.SwarmMasterNode {
+		if k != machineName {
+			masters = append(masters, k)
+		}
+	}
+	c.Config.SwarmMasterNode = masters
+
+	// the other nodes will join the Swarm mode cluster using the first remaining manager
+	if c.Config.SwarmModeGlobalConfig != nil && c.Config.SwarmModeGlobalConfig.BootstrapManagerURL == removedManagerURL && len(masters) > 0 {
+		if ip, ok := c.Config.HostsLookupTable[masters[0]]; ok {
+			c.Config.SwarmModeGlobalConfig.BootstrapManagerURL = net.JoinHostPort(ip, "2377")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/machine/commands/mcndirs"
+	"github.com/docker/machine/libmachine"
+)
+
+// stateFileExt is the extension of the clusters state files
+const stateFileExt = ".json"
+
+// StateDir returns the directory storing the clusters state files (inside the Docker Machine storage)
+func StateDir() string {
+	return filepath.Join(mcndirs.GetBaseDir(), "docker-g5k")
+}
+
+// stateFilePath returns the path of the state file for the given cluster name
+func stateFilePath(name string) string {
+	return filepath.Join(StateDir(), name+stateFileExt)
+}
+
+// Save writes the cluster state file (the previous state is replaced atomically)
+func (c *Cluster) Save() error {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	// marshal cluster state
+	data, err := json.MarshalIndent(c, "", "    ")
+	if err != nil {
+		return fmt.Errorf("Unable to marshal the state of the cluster '%s': '%s'", c.Name, err)
+	}
+
+	// create state directory if needed (the state contains credentials, only the user can read it)
+	if err := os.MkdirAll(StateDir(), 0700); err != nil {
+		return fmt.Errorf("Unable to create the clusters state directory: '%s'", err)
+	}
+
+	// write to a temporary file then rename it to never leave a partially written state
+	tmpPath := stateFilePath(c.Name) + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("Unable to write the state of the cluster '%s': '%s'", c.Name, err)
+	}
+
+	if err := os.Rename(tmpPath, stateFilePath(c.Name)); err != nil {
+		return fmt.Errorf("Unable to write the state of the cluster '%s': '%s'", c.Name, err)
+	}
+
+	return nil
+}
+
+// RemoveState removes the cluster state file
+func (c *Cluster) RemoveState() error {
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+
+	if err := os.Remove(stateFilePath(c.Name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove the state of the cluster '%s': '%s'", c.Name, err)
+	}
+
+	return nil
+}
+
+// Exists returns true if a cluster with the given name have a state file, false otherwise
+func Exists(name string) bool {
+	_, err := os.Stat(stateFilePath(name))
+	return err == nil
+}
+
+// LoadCluster reload a cluster from its state file
+func LoadCluster(name string) (*Cluster, error) {
+	data, err := ioutil.ReadFile(stateFilePath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("The cluster '%s' does not exist", name)
+		}
+
+		return nil, fmt.Errorf("Unable to read the state of the cluster '%s': '%s'", name, err)
+	}
+
+	// unmarshal cluster state
+	var c Cluster
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("Unable to unmarshal the state of the cluster '%s': '%s'", name, err)
+	}
+
+	if c.Config == nil {
+		return nil, fmt.Errorf("The state of the cluster '%s' does not contain its configuration", name)
+	}
+
+	if c.Nodes == nil {
+		c.Nodes = make(map[string]*Node)
+	}
+
+	if c.Config.HostsLookupTable == nil {
+		c.Config.HostsLookupTable = make(map[string]string)
+	}
+
+	// create a new libmachine client (not stored in the state)
+	c.Config.LibMachineClient = libmachine.NewClient(mcndirs.GetBaseDir(), mcndirs.GetMachineCertDir())
+
+	// link nodes to the cluster configuration
+	for _, n := range c.Nodes {
+		n.clusterConfig = c.Config
+	}
+
+	return &c, nil
+}
+
+// ListClusters returns the names of all the clusters having a state file
+func ListClusters() ([]string, error) {
+	files, err := ioutil.ReadDir(StateDir())
+	if err != nil {
+		// no state directory means no cluster
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+
+		return nil, fmt.Errorf("Unable to read the clusters state directory: '%s'", err)
+	}
+
+	names := []string{}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), stateFileExt) {
+			names = append(names, strings.TrimSuffix(f.Name(), stateFileExt))
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,55 @@
+package cluster
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/swarm"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveLoadCluster(t *testing.T) {
+	storePath, err := ioutil.TempDir("", "docker-g5k")
+	assert.NoError(t, err)
+	defer os.RemoveAll(storePath)
+	os.Setenv("MACHINE_STORAGE_PATH", storePath)
+	defer os.Unsetenv("MACHINE_STORAGE_PATH")
+
+	c := NewCluster("test", &GlobalConfig{
+		HostsLookupTable:      map[string]string{"lille-0": "10.0.0.0"},
+		SwarmModeGlobalConfig: &swarm.SwarmModeGlobalConfig{ManagerToken: "manager", WorkerToken: "worker"},
+		SwarmMasterNode:       []string{"test-lille-0"},
+	})
+	c.CreateNodes(map[string]int{"lille": 1})
+	j := c.AddJob("lille", 1)
+	j.ID = 1234
+	assert.NoError(t, c.SetJobPhase(j, JobPhaseSubmitted))
+	assert.NoError(t, c.Save())
+
+	names, err := ListClusters()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"test"}, names)
+
+	l, err := LoadCluster("test")
+	assert.NoError(t, err)
+	assert.Equal(t, c.Config.HostsLookupTable, l.Config.HostsLookupTable)
+	assert.Equal(t, c.Config.SwarmModeGlobalConfig, l.Config.SwarmModeGlobalConfig)
+	assert.Equal(t, c.Jobs, l.Jobs)
+	assert.True(t, Exists("test"))
+	assert.True(t, l.Nodes["test-lille-0"].isSwarmMaster())
+
+	assert.NoError(t, l.RemoveState())
+	assert.False(t, Exists("test"))
+	_, err = LoadCluster("test")
+	assert.Error(t, err)
+}
+
+func TestListClustersNoStateDir(t *testing.T) {
+	os.Setenv("MACHINE_STORAGE_PATH", "/nonexistent/docker-g5k")
+	defer os.Unsetenv("MACHINE_STORAGE_PATH")
+
+	names, err := ListClusters()
+	assert.NoError(t, err)
+	assert.Empty(t, names)
+}
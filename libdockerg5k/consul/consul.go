@@ -0,0 +1,87 @@
+package consul
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+)
+
+// ContainerName is the name of the Consul container running on the Swarm master nodes
+const ContainerName = "docker-g5k-consul"
+
+// GenerateClusterStorageURL returns a string used for Docker Engine/Swarm cluster-store parameter (format=consul://node1:8500)
+// Only one endpoint is supported by the Docker Engine and Swarm Consul backend, the first master node is used
+func GenerateClusterStorageURL(consulMasterNodes []string, hostsLookupTable map[string]string) string {
+	if len(consulMasterNodes) == 0 {
+		return "consul://"
+	}
+
+	return fmt.Sprintf("consul://%s:8500", hostsLookupTable[consulMasterNodes[0]])
+}
+
+// generateRetryJoin returns the '-retry-join' parameters for the other Consul servers
+func generateRetryJoin(consulMasterNodes []string, hostsLookupTable map[string]string) string {
+	params := []string{}
+	for _, n := range consulMasterNodes {
+		params = append(params, fmt.Sprintf("-retry-join=%s", hostsLookupTable[n]))
+	}
+
+	return strings.Join(params, " ")
+}
+
+// StartClusterStorage start a Consul server container on the Swarm master nodes for cluster k/v storage
+func StartClusterStorage(host *host.Host, consulMasterNodes []string, hostsLookupTable map[string]string) error {
+	// search current host in Swarm master nodes list
+	for _, nodeName := range consulMasterNodes {
+		// host found in Swarm master nodes list
+		if nodeName == host.Name {
+			// remove the container left by a previous provisionning
+			if _, err := host.RunSSHCommand("docker rm -f " + ContainerName + " >/dev/null 2>&1 || true"); err != nil {
+				return err
+			}
+
+			// start Consul container
+			if _, err := host.RunSSHCommand(fmt.Sprintf("docker run -td --restart=always --net=host --name %s consul:1.6 agent -server -node=%s -bootstrap-expect=%d -bind=%s -client=0.0.0.0 %s", ContainerName, nodeName, len(consulMasterNodes), hostsLookupTable[nodeName], generateRetryJoin(consulMasterNodes, hostsLookupTable))); err != nil {
+				return err
+			}
+
+			return nil
+		}
+	}
+
+	// host not found in Swarm master nodes list
+	return fmt.Errorf("This host is not in the given Consul master nodes list")
+}
+
+// parseLeaderAddress returns the address of the Raft leader from the output of 'consul info', or an empty string if no leader is elected
+func parseLeaderAddress(info string) string {
+	for _, line := range strings.Split(info, "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == "leader_addr" {
+			return strings.TrimSpace(kv[1])
+		}
+	}
+
+	return ""
+}
+
+// WaitForQuorum wait until the Consul servers running on the given hosts have elected a leader, or returns an error after the timeout
+func WaitForQuorum(hosts []*host.Host, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		// a leader is only elected when the expected number of servers have joined
+		for _, h := range hosts {
+			if info, err := h.RunSSHCommand("docker exec " + ContainerName + " consul info 2>&1"); err == nil && parseLeaderAddress(info) != "" {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The Consul servers did not elect a leader after %s", timeout)
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,30 @@
+package consul
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateClusterStorageURLMultiMaster(t *testing.T) {
+	masters := []string{"lille-0", "sophia-1"}
+	hostsLookup := map[string]string{"lille-0": "10.0.0.0", "sophia-1": "10.1.1.1"}
+	url := GenerateClusterStorageURL(masters, hostsLookup)
+	assert.Equal(t, "consul://10.0.0.0:8500", url)
+}
+
+func TestGenerateRetryJoinMultiMaster(t *testing.T) {
+	masters := []string{"lille-0", "sophia-1"}
+	hostsLookup := map[string]string{"lille-0": "10.0.0.0", "sophia-1": "10.1.1.1"}
+	assert.Equal(t, "-retry-join=10.0.0.0 -retry-join=10.1.1.1", generateRetryJoin(masters, hostsLookup))
+}
+
+func TestParseLeaderAddress(t *testing.T) {
+	info := "consul:\n\tknown_servers = 2\n\tleader = true\n\tleader_addr = 10.0.0.0:8300\n\tserver = true\n"
+	assert.Equal(t, "10.0.0.0:8300", parseLeaderAddress(info))
+}
+
+func TestParseLeaderAddressNoLeader(t *testing.T) {
+	info := "consul:\n\tknown_servers = 2\n\tleader = false\n\tleader_addr = \n\tserver = true\n"
+	assert.Equal(t, "", parseLeaderAddress(info))
+}
@@ -0,0 +1,89 @@
+package etcd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+)
+
+// ContainerName is the name of the etcd container running on the Swarm master nodes
+const ContainerName = "docker-g5k-etcd"
+
+// GenerateClusterStorageURL returns a string used for Docker Engine/Swarm cluster-store parameter (format=etcd://node1:2379,node2:2379,nodeN:2379)
+func GenerateClusterStorageURL(etcdMasterNodes []string, hostsLookupTable map[string]string) string {
+	// get the master nodes IP address from the hosts lookup table
+	endpoints := []string{}
+	for _, n := range etcdMasterNodes {
+		endpoints = append(endpoints, fmt.Sprintf("%s:2379", hostsLookupTable[n]))
+	}
+
+	return fmt.Sprintf("etcd://%s", strings.Join(endpoints, ","))
+}
+
+// generateInitialCluster returns the list of etcd members for the '--initial-cluster' parameter
+func generateInitialCluster(etcdMasterNodes []string, hostsLookupTable map[string]string) string {
+	members := []string{}
+	for _, n := range etcdMasterNodes {
+		members = append(members, fmt.Sprintf("%s=http://%s:2380", n, hostsLookupTable[n]))
+	}
+
+	return strings.Join(members, ",")
+}
+
+// StartClusterStorage start an etcd k/v container on the Swarm master nodes for cluster k/v storage
+func StartClusterStorage(host *host.Host, etcdMasterNodes []string, hostsLookupTable map[string]string) error {
+	// search current host in Swarm master nodes list
+	for _, nodeName := range etcdMasterNodes {
+		// host found in Swarm master nodes list
+		if nodeName == host.Name {
+			ip := hostsLookupTable[nodeName]
+
+			// remove the container left by a previous provisionning
+			if _, err := host.RunSSHCommand("docker rm -f " + ContainerName + " >/dev/null 2>&1 || true"); err != nil {
+				return err
+			}
+
+			// start etcd container
+			if _, err := host.RunSSHCommand(fmt.Sprintf("docker run -td --restart=always --net=host --name %s quay.io/coreos/etcd:v3.3.25 etcd --name %s --data-dir /etcd-data --listen-client-urls http://0.0.0.0:2379 --advertise-client-urls http://%s:2379 --listen-peer-urls http://0.0.0.0:2380 --initial-advertise-peer-urls http://%s:2380 --initial-cluster %s --initial-cluster-state new", ContainerName, nodeName, ip, ip, generateInitialCluster(etcdMasterNodes, hostsLookupTable))); err != nil {
+				return err
+			}
+
+			return nil
+		}
+	}
+
+	// host not found in Swarm master nodes list
+	return fmt.Errorf("This host is not in the given etcd master nodes list")
+}
+
+// isClusterHealthy returns true if the output of 'etcdctl cluster-health' reports a healthy cluster
+func isClusterHealthy(status string) bool {
+	for _, line := range strings.Split(status, "\n") {
+		if strings.TrimSpace(line) == "cluster is healthy" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WaitForQuorum wait until the etcd cluster running on the given hosts is healthy, or returns an error after the timeout
+func WaitForQuorum(hosts []*host.Host, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		// any member can report the cluster health
+		for _, h := range hosts {
+			if status, err := h.RunSSHCommand("docker exec " + ContainerName + " etcdctl cluster-health 2>&1"); err == nil && isClusterHealthy(status) {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("The etcd cluster is not healthy after %s", timeout)
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
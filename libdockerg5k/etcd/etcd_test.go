@@ -0,0 +1,32 @@
+package etcd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateClusterStorageURLSingleMaster(t *testing.T) {
+	masters := []string{"lille-0"}
+	hostsLookup := map[string]string{"lille-0": "10.0.0.0"}
+	url := GenerateClusterStorageURL(masters, hostsLookup)
+	assert.Equal(t, "etcd://10.0.0.0:2379", url)
+}
+
+func TestGenerateClusterStorageURLMultiMaster(t *testing.T) {
+	masters := []string{"lille-0", "sophia-1", "lyon-2"}
+	hostsLookup := map[string]string{"lille-0": "10.0.0.0", "sophia-1": "10.1.1.1", "lyon-2": "10.2.2.2"}
+	url := GenerateClusterStorageURL(masters, hostsLookup)
+	assert.Equal(t, "etcd://10.0.0.0:2379,10.1.1.1:2379,10.2.2.2:2379", url)
+}
+
+func TestGenerateInitialClusterMultiMaster(t *testing.T) {
+	masters := []string{"lille-0", "sophia-1"}
+	hostsLookup := map[string]string{"lille-0": "10.0.0.0", "sophia-1": "10.1.1.1"}
+	assert.Equal(t, "lille-0=http://10.0.0.0:2380,sophia-1=http://10.1.1.1:2380", generateInitialCluster(masters, hostsLookup))
+}
+
+func TestIsClusterHealthy(t *testing.T) {
+	assert.True(t, isClusterHealthy("member 8e9e05c52164694d is healthy: got healthy result from http://10.0.0.0:2379\ncluster is healthy\n"))
+	assert.False(t, isClusterHealthy("cluster may be unhealthy: failed to list members\n"))
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Type is the type of a cluster lifecycle event
+type Type string
+
+const (
+	// JobSubmitted is emitted when a job is submitted to OAR
+	JobSubmitted Type = "job-submitted"
+	// JobWaiting is emitted when waiting for a submitted job to start
+	JobWaiting Type = "job-waiting"
+	// JobReady is emitted when a job is running and its nodes are available
+	JobReady Type = "job-ready"
+	// DeploymentStarted is emitted when the deployment of the nodes of a job is submitted to Kadeploy
+	DeploymentStarted Type = "deployment-started"
+	// DeploymentDone is emitted when the nodes of a job are deployed
+	DeploymentDone Type = "deployment-done"
+	// NodeEngineInstall is emitted when the machine creation and the Docker Engine installation of a node start
+	NodeEngineInstall Type = "node-engine-install"
+	// NodeConfiguring is emitted when the hosts mapping, cluster storage and networking configuration of a node start
+	NodeConfiguring Type = "node-configuring"
+	// NodeSwarmJoin is emitted when a node starts to join the Swarm mode cluster
+	NodeSwarmJoin Type = "node-swarm-join"
+	// NodeProvisioned is emitted when a node is provisioned
+	NodeProvisioned Type = "node-provisioned"
+	// NodeFailed is emitted when the provisionning of a node failed
+	NodeFailed Type = "node-failed"
+	// SwarmInitialized is emitted when the Swarm mode cluster is initialized on the bootstrap manager
+	SwarmInitialized Type = "swarm-initialized"
+	// ClusterReady is emitted when the cluster is created
+	ClusterReady Type = "cluster-ready"
+	// JobKilled is emitted when a job is killed
+	JobKilled Type = "job-killed"
+	// MachineRemoved is emitted when a machine is removed from the Docker Machine store
+	MachineRemoved Type = "machine-removed"
+	// ClusterRemoved is emitted when the state of a cluster is removed
+	ClusterRemoved Type = "cluster-removed"
+)
+
+// Event is a cluster lifecycle event
+type Event struct {
+	Time    time.Time `json:"time"`
+	Type    Type      `json:"type"`
+	Cluster string    `json:"cluster,omitempty"`
+	Site    string    `json:"site,omitempty"`
+	JobID   int       `json:"job_id,omitempty"`
+	Machine string    `json:"machine,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// Listener handles the emitted events
+type Listener interface {
+	Handle(e Event)
+}
+
+// Emitter send the events to its listeners, a nil Emitter discards the events
+type Emitter struct {
+	// Cluster is the cluster name set on the events without one
+	Cluster string
+
+	listeners []Listener
+
+	// serialize the events sent to the listeners (events are emitted by parallel goroutines)
+	lock sync.Mutex
+}
+
+// NewEmitter returns a new Emitter for the given cluster
+func NewEmitter(cluster string) *Emitter {
+	return &Emitter{Cluster: cluster}
+}
+
+// Subscribe add a listener to the emitter
+func (em *Emitter) Subscribe(l Listener) {
+	em.lock.Lock()
+	defer em.lock.Unlock()
+
+	em.listeners = append(em.listeners, l)
+}
+
+// Emit send the event to the listeners, the event time and cluster are set if empty
+func (em *Emitter) Emit(e Event) {
+	if em == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	em.lock.Lock()
+	defer em.lock.Unlock()
+
+	if e.Cluster == "" {
+		e.Cluster = em.Cluster
+	}
+
+	for _, l := range em.listeners {
+		l.Handle(e)
+	}
+}
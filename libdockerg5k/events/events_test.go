@@ -0,0 +1,87 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recorder stores the received events
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) Handle(e Event) {
+	r.events = append(r.events, e)
+}
+
+func TestEmitNilEmitter(t *testing.T) {
+	var em *Emitter
+	em.Emit(Event{Type: ClusterReady})
+}
+
+func TestEmitSetTimeAndCluster(t *testing.T) {
+	r := &recorder{}
+	em := NewEmitter("test")
+	em.Subscribe(r)
+	em.Emit(Event{Type: JobReady, Site: "lille", JobID: 42})
+
+	assert.Equal(t, 1, len(r.events))
+	assert.Equal(t, "test", r.events[0].Cluster)
+	assert.False(t, r.events[0].Time.IsZero())
+}
+
+func TestLineReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewLineReporter(&buf)
+	r.Handle(Event{Time: time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC), Type: NodeProvisioned, Site: "lille", JobID: 42, Machine: "test-lille-0"})
+
+	assert.Equal(t, "2026-10-17T10:00:00Z node-provisioned site=lille job=42 machine=test-lille-0\n", buf.String())
+}
+
+func TestTableReporterCountsProvisionedNodes(t *testing.T) {
+	now := time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC)
+	r := NewTableReporter(&bytes.Buffer{})
+	r.Handle(Event{Time: now, Type: JobReady, Site: "lille", JobID: 42})
+	r.Handle(Event{Time: now, Type: NodeProvisioned, Site: "lille", JobID: 42, Machine: "test-lille-0"})
+	r.Handle(Event{Time: now, Type: NodeEngineInstall, Site: "lille", JobID: 42, Machine: "test-lille-1"})
+
+	table := r.table(now.Add(time.Minute))
+	assert.Contains(t, table, "job-ready")
+	assert.Contains(t, table, "test-lille-1")
+	assert.NotContains(t, table, "test-lille-0")
+	assert.Contains(t, table, "1/2 node(s) provisioned, 0 failed")
+}
+
+func TestTableReporterPrintsLogsAboveTable(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewTableReporter(&buf)
+	r.Handle(Event{Time: time.Now(), Type: JobReady, Site: "lille", JobID: 42})
+	r.render()
+
+	fmt.Fprintln(r, "Continuing without 1 failed site(s)")
+	buf.Reset()
+	r.render()
+
+	out := buf.String()
+	assert.True(t, strings.Index(out, "Continuing without 1 failed site(s)") < strings.Index(out, "job-ready"))
+	assert.True(t, strings.HasPrefix(out, "\033["))
+
+	// the logs are printed only once
+	fmt.Fprintln(r, "Provisionning failed on 1/2 node(s)")
+	buf.Reset()
+	r.render()
+	assert.NotContains(t, buf.String(), "Continuing without")
+}
+
+func TestJSONReporter(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSONReporter(&buf)
+	r.Handle(Event{Time: time.Date(2026, 10, 17, 10, 0, 0, 0, time.UTC), Type: JobSubmitted, Cluster: "test", Site: "lille", JobID: 42})
+
+	assert.Equal(t, `{"time":"2026-10-17T10:00:00Z","type":"job-submitted","cluster":"test","site":"lille","job_id":42}`+"\n", buf.String())
+}
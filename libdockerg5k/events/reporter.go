@@ -0,0 +1,241 @@
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// maxTableNodes is the maximum number of nodes in progress displayed in the live table
+const maxTableNodes = 20
+
+// LineReporter print each event on a line (for non-interactive outputs)
+type LineReporter struct {
+	w io.Writer
+}
+
+// NewLineReporter returns a new LineReporter writing to the given writer
+func NewLineReporter(w io.Writer) *LineReporter {
+	return &LineReporter{w: w}
+}
+
+// Handle print the event
+func (r *LineReporter) Handle(e Event) {
+	fields := []string{e.Time.Format(time.RFC3339), string(e.Type)}
+	if e.Site != "" {
+		fields = append(fields, fmt.Sprintf("site=%s", e.Site))
+	}
+	if e.JobID != 0 {
+		fields = append(fields, fmt.Sprintf("job=%d", e.JobID))
+	}
+	if e.Machine != "" {
+		fields = append(fields, fmt.Sprintf("machine=%s", e.Machine))
+	}
+	if e.Message != "" {
+		fields = append(fields, e.Message)
+	}
+
+	fmt.Fprintln(r.w, strings.Join(fields, " "))
+}
+
+// JSONReporter write each event as a JSON object on a line (for automation)
+type JSONReporter struct {
+	w io.Writer
+}
+
+// NewJSONReporter returns a new JSONReporter writing to the given writer
+func NewJSONReporter(w io.Writer) *JSONReporter {
+	return &JSONReporter{w: w}
+}
+
+// Handle write the event
+func (r *JSONReporter) Handle(e Event) {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+
+	r.w.Write(append(b, '\n'))
+}
+
+// tableRow is the last known status of a job or a node
+type tableRow struct {
+	site    string
+	jobID   int
+	status  Type
+	message string
+	since   time.Time
+}
+
+// TableReporter display the status of the jobs and nodes in a table refreshed periodically (for terminals)
+type TableReporter struct {
+	w io.Writer
+
+	cluster tableRow
+	jobs    map[string]*tableRow
+	nodes   map[string]*tableRow
+
+	// number of lines of the last rendered table (erased before the next rendering)
+	lines int
+	dirty bool
+
+	// logs written since the last rendering (printed above the table)
+	logs bytes.Buffer
+
+	stop chan bool
+	done chan bool
+	lock sync.Mutex
+}
+
+// NewTableReporter returns a new TableReporter writing to the given terminal
+func NewTableReporter(w io.Writer) *TableReporter {
+	return &TableReporter{
+		w:     w,
+		jobs:  make(map[string]*tableRow),
+		nodes: make(map[string]*tableRow),
+	}
+}
+
+// Handle update the status of the job or the node of the event
+func (r *TableReporter) Handle(e Event) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	row := &tableRow{site: e.Site, jobID: e.JobID, status: e.Type, message: e.Message, since: e.Time}
+	switch {
+	case e.Machine != "":
+		r.nodes[e.Machine] = row
+	case e.JobID != 0:
+		r.jobs[fmt.Sprintf("%s/%d", e.Site, e.JobID)] = row
+	default:
+		r.cluster = *row
+	}
+
+	r.dirty = true
+}
+
+// Write add logs to print above the table at the next rendering (the logs would be erased with the table if written directly to the terminal)
+func (r *TableReporter) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.dirty = true
+	return r.logs.Write(p)
+}
+
+// Start refresh the table periodically until Stop is called
+func (r *TableReporter) Start(interval time.Duration) {
+	r.stop = make(chan bool)
+	r.done = make(chan bool)
+
+	go func() {
+		defer close(r.done)
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				r.render()
+			case <-r.stop:
+				r.render()
+				return
+			}
+		}
+	}()
+}
+
+// Stop render the table a last time and stop refreshing it
+func (r *TableReporter) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+// render replace the previous table with the current status
+func (r *TableReporter) render() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if !r.dirty {
+		return
+	}
+
+	table := r.table(time.Now())
+
+	// move the cursor to the beginning of the previous table and erase it
+	if r.lines > 0 {
+		fmt.Fprintf(r.w, "\033[%dA\033[J", r.lines)
+	}
+
+	// the logs stay above the table
+	r.logs.WriteTo(r.w)
+
+	io.WriteString(r.w, table)
+	r.lines = strings.Count(table, "\n")
+	r.dirty = false
+}
+
+// table returns the status table (jobs, nodes summary, then nodes in progress or failed)
+func (r *TableReporter) table(now time.Time) string {
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 5, 1, 3, ' ', 0)
+
+	if r.cluster.status != "" {
+		fmt.Fprintf(w, "CLUSTER: %s %s\n", r.cluster.status, r.cluster.message)
+	}
+
+	fmt.Fprintf(w, "NAME\tSITE\tJOB ID\tSTATUS\tSINCE\tMESSAGE\n")
+
+	// jobs
+	keys := []string{}
+	for k := range r.jobs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		j := r.jobs[k]
+		fmt.Fprintf(w, "job\t%s\t%d\t%s\t%s\t%s\n", j.site, j.jobID, j.status, now.Sub(j.since).Truncate(time.Second), j.message)
+	}
+
+	// nodes (provisioned nodes are only counted)
+	keys = []string{}
+	provisioned := 0
+	failed := 0
+	for k, n := range r.nodes {
+		switch n.status {
+		case NodeProvisioned:
+			provisioned++
+			continue
+		case NodeFailed:
+			failed++
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for i, k := range keys {
+		if i == maxTableNodes {
+			fmt.Fprintf(w, "... %d more node(s)\t\t\t\t\t\n", len(keys)-maxTableNodes)
+			break
+		}
+
+		n := r.nodes[k]
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\n", k, n.site, n.jobID, n.status, now.Sub(n.since).Truncate(time.Second), n.message)
+	}
+
+	w.Flush()
+
+	if len(r.nodes) > 0 {
+		fmt.Fprintf(&buf, "%d/%d node(s) provisioned, %d failed\n", provisioned, len(r.nodes), failed)
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,72 @@
+package g5k
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// apiSiteURL is the base URL of the Grid5000 API for a site
+const apiSiteURL = "https://api.grid5000.fr/stable/sites/%s"
+
+// apiRequestTimeout is the maximum duration of a request to the Grid5000 API (including the response body read)
+const apiRequestTimeout = 30 * time.Second
+
+// apiHTTPClient is the HTTP client used for the requests to the Grid5000 API
+var apiHTTPClient = &http.Client{Timeout: apiRequestTimeout}
+
+// siteAPIRequest send an authenticated request to the Grid5000 API of a site, and unmarshal the response in result (if not nil)
+// It is used for the API calls not provided by the driver API client
+func (g *G5K) siteAPIRequest(method string, site string, path string, body interface{}, result interface{}) error {
+	// marshal request body
+	var reqBody []byte
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		reqBody = b
+	}
+
+	// create the request
+	req, err := http.NewRequest(method, fmt.Sprintf(apiSiteURL, site)+path, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+
+	req.SetBasicAuth(g.username, g.password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	// send the request
+	resp, err := apiHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// the API returns the error message in the response body
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("The API returned '%s': %s", resp.Status, bytes.TrimSpace(respBody))
+	}
+
+	// unmarshal response
+	if result != nil {
+		if err := json.Unmarshal(respBody, result); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,7 +1,11 @@
 package g5k
 
 import (
+	"fmt"
+
 	"github.com/Spirals-Team/docker-machine-driver-g5k/api"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
 )
 
 // DeployNodes submit a deployment request and returns the deployed nodes hostname
@@ -28,6 +32,8 @@ func (g *G5K) DeployNodes(site string, sshPublicKey string, jobID int, image str
 		return nil, err
 	}
 
+	g.events.Emit(events.Event{Type: events.DeploymentStarted, Site: site, JobID: jobID, Message: fmt.Sprintf("deployment %v", deploymentID)})
+
 	// wait until deployment finish
 	if err := siteAPI.WaitUntilDeploymentIsFinished(deploymentID); err != nil {
 		return nil, err
@@ -39,5 +45,7 @@ func (g *G5K) DeployNodes(site string, sshPublicKey string, jobID int, image str
 		return nil, err
 	}
 
+	g.events.Emit(events.Event{Type: events.DeploymentDone, Site: site, JobID: jobID, Message: fmt.Sprintf("%d node(s) deployed", len(deployment.Nodes))})
+
 	return deployment.Nodes, nil
 }
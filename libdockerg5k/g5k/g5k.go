@@ -1,8 +1,12 @@
 package g5k
 
 import (
+	"sync"
+
 	"github.com/Spirals-Team/docker-machine-driver-g5k/api"
 	"github.com/Spirals-Team/docker-machine-driver-g5k/driver"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
 )
 
 // G5K stores all informations needed to use the Grid5000 API
@@ -10,6 +14,12 @@ type G5K struct {
 	username string
 	password string
 	sitesAPI map[string]*api.Client
+
+	// protect the sites API clients cache (sites are processed in parallel)
+	sitesAPILock sync.Mutex
+
+	// jobs and deployments progress (discarded if nil)
+	events *events.Emitter
 }
 
 // Init initialize a new G5K struct with the given parameters
@@ -21,6 +31,11 @@ func Init(username string, password string) *G5K {
 	}
 }
 
+// SetEventsEmitter set the emitter of the jobs and deployments progress events
+func (g *G5K) SetEventsEmitter(em *events.Emitter) {
+	g.events = em
+}
+
 // CheckVpnConnection check if the VPN is connected and properly configured (DNS) by trying to connect to the all sites frontend SSH server
 func (g *G5K) CheckVpnConnection(nodesReservation map[string]int) error {
 	for site := range nodesReservation {
@@ -39,6 +54,9 @@ func (g *G5K) createSiteAPI(site string) {
 
 // getSiteAPI returns the API client for the given site (create it if not exist)
 func (g *G5K) getSiteAPI(site string) *api.Client {
+	g.sitesAPILock.Lock()
+	defer g.sitesAPILock.Unlock()
+
 	// create API client for the site if it does not exist
 	if _, ok := g.sitesAPI[site]; !ok {
 		g.createSiteAPI(site)
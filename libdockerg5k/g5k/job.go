@@ -2,33 +2,247 @@ package g5k
 
 import (
 	"fmt"
+	"time"
 
-	"github.com/Spirals-Team/docker-machine-driver-g5k/api"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/events"
 )
 
-// ReserveNodes allocate a new job with the required number of nodes on the given site, and returns the Job ID
-func (g *G5K) ReserveNodes(site string, nbNodes int, resourceProperties string, walltime string) (int, error) {
-	// create a new job request with given parameters
-	jobReq := api.JobRequest{
-		Resources:  fmt.Sprintf("nodes=%v,walltime=%s", nbNodes, walltime),
-		Command:    "sleep 365d",
-		Properties: resourceProperties,
-		Types:      []string{"deploy"},
+// ReservationDateFormat is the format of the advance reservations start date
+const ReservationDateFormat = "2006-01-02 15:04:05"
+
+// JobCommand is the command of the jobs submitted by docker-g5k
+const JobCommand = "sleep 365d"
+
+// JobName is the name of the jobs submitted by docker-g5k (used to identify them)
+const JobName = "docker-g5k"
+
+// jobSubmission is the API request to submit a job (the job name is not provided by the driver API client)
+type jobSubmission struct {
+	Resources   string   `json:"resources"`
+	Command     string   `json:"command"`
+	Properties  string   `json:"properties,omitempty"`
+	Reservation string   `json:"reservation,omitempty"`
+	Types       []string `json:"types"`
+	Name        string   `json:"name"`
+}
+
+// jobSubmissionResponse is the API response to a job submission
+type jobSubmissionResponse struct {
+	UID int `json:"uid"`
+}
+
+// reservationLocation returns the timezone of the Grid'5000 sites ('Europe/Paris', or the local timezone if not available)
+func reservationLocation() *time.Location {
+	if location, err := time.LoadLocation("Europe/Paris"); err == nil {
+		return location
+	}
+
+	return time.Local
+}
+
+// ParseReservationDate returns the date of an advance reservation start date given in the sites local time
+func ParseReservationDate(value string) (time.Time, error) {
+	return time.ParseInLocation(ReservationDateFormat, value, reservationLocation())
+}
+
+// FormatReservationDate returns the given date in the format and timezone (sites local time) expected for advance reservations
+func FormatReservationDate(t time.Time) string {
+	return t.In(reservationLocation()).Format(ReservationDateFormat)
+}
+
+// SubmitNodesReservation submit a new job with the required number of nodes on the given site, and returns the Job ID (the job may not be ready yet)
+// The job starts as soon as possible if the reservation start date is empty, or at the given date (advance reservation)
+func (g *G5K) SubmitNodesReservation(site string, nbNodes int, resourceProperties string, walltime string, reservation string) (int, error) {
+	// create a new job request with given parameters, named to be identified as a docker-g5k job
+	jobReq := jobSubmission{
+		Resources:   fmt.Sprintf("nodes=%v,walltime=%s", nbNodes, walltime),
+		Command:     JobCommand,
+		Properties:  resourceProperties,
+		Reservation: reservation,
+		Types:       []string{"deploy"},
+		Name:        JobName,
+	}
+
+	// submit job request
+	var resp jobSubmissionResponse
+	if err := g.siteAPIRequest("POST", site, "/jobs", jobReq, &resp); err != nil {
+		return 0, err
 	}
+	jobID := resp.UID
+
+	g.events.Emit(events.Event{Type: events.JobSubmitted, Site: site, JobID: jobID, Message: fmt.Sprintf("%d node(s)", nbNodes)})
+
+	return jobID, nil
+}
 
+// WaitUntilJobIsReady wait until the given job on the given site reach the 'ready' state
+func (g *G5K) WaitUntilJobIsReady(site string, jobID int) error {
 	// get site API client
 	siteAPI := g.getSiteAPI(site)
 
+	g.events.Emit(events.Event{Type: events.JobWaiting, Site: site, JobID: jobID})
+
+	// wait until job reach 'ready' state
+	if err := siteAPI.WaitUntilJobIsReady(jobID); err != nil {
+		return err
+	}
+
+	g.events.Emit(events.Event{Type: events.JobReady, Site: site, JobID: jobID})
+
+	return nil
+}
+
+// ReserveNodes allocate a new job with the required number of nodes on the given site, and returns the Job ID
+func (g *G5K) ReserveNodes(site string, nbNodes int, resourceProperties string, walltime string) (int, error) {
 	// submit job request
-	jobID, err := siteAPI.SubmitJob(jobReq)
+	jobID, err := g.SubmitNodesReservation(site, nbNodes, resourceProperties, walltime, "")
 	if err != nil {
 		return 0, err
 	}
 
 	// wait until job reach 'ready' state
-	if err := siteAPI.WaitUntilJobIsReady(jobID); err != nil {
+	if err := g.WaitUntilJobIsReady(site, jobID); err != nil {
 		return 0, err
 	}
 
 	return jobID, nil
 }
+
+// GetJobState returns the current state of the given job on the given site
+func (g *G5K) GetJobState(site string, jobID int) (string, error) {
+	// get site API client
+	siteAPI := g.getSiteAPI(site)
+
+	// get job informations
+	job, err := siteAPI.GetJob(jobID)
+	if err != nil {
+		return "", err
+	}
+
+	return job.State, nil
+}
+
+// KillJob kill the given job on the given site
+func (g *G5K) KillJob(site string, jobID int) error {
+	// get site API client
+	siteAPI := g.getSiteAPI(site)
+
+	// send API call to kill job
+	if err := siteAPI.KillJob(jobID); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// JobStatus is the OAR status of a job
+type JobStatus struct {
+	State     string
+	StartedAt time.Time     // zero if the job is not running
+	Walltime  time.Duration // zero if the job is ended
+}
+
+// jobTimesResponse is the API response to a job request, only the timing informations not provided by the driver API client are decoded
+type jobTimesResponse struct {
+	StartedAt int64 `json:"started_at"`
+	Walltime  int64 `json:"walltime"`
+}
+
+// IsEnded returns true if the job is terminated or in error
+func (s *JobStatus) IsEnded() bool {
+	return s.State == "terminated" || s.State == "error"
+}
+
+// EndsAt returns the end date of a running job (zero if the job is not running)
+func (s *JobStatus) EndsAt() time.Time {
+	if s.State != "running" || s.StartedAt.IsZero() {
+		return time.Time{}
+	}
+
+	return s.StartedAt.Add(s.Walltime)
+}
+
+// Remaining returns the remaining walltime of a running job at the given date (0 if the job is not running)
+func (s *JobStatus) Remaining(now time.Time) time.Duration {
+	if s.State != "running" || s.StartedAt.IsZero() {
+		return 0
+	}
+
+	if r := s.StartedAt.Add(s.Walltime).Sub(now); r > 0 {
+		return r
+	}
+
+	return 0
+}
+
+// GetJobStatus returns the state of the given job on the given site, and its walltime and start date if it is not ended
+func (g *G5K) GetJobStatus(site string, jobID int) (*JobStatus, error) {
+	// get site API client
+	siteAPI := g.getSiteAPI(site)
+
+	// get job state
+	job, err := siteAPI.GetJob(jobID)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &JobStatus{State: job.State}
+	if status.IsEnded() {
+		return status, nil
+	}
+
+	// get walltime and start date of the job (not provided by the driver API client)
+	var resp jobTimesResponse
+	if err := g.siteAPIRequest("GET", site, fmt.Sprintf("/jobs/%d", jobID), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	status.Walltime = time.Duration(resp.Walltime) * time.Second
+	if resp.StartedAt > 0 {
+		status.StartedAt = time.Unix(resp.StartedAt, 0)
+	}
+
+	return status, nil
+}
+
+// aliveJobStates are the OAR states of the jobs not ended yet
+const aliveJobStates = "waiting,hold,toLaunch,toAckReservation,launching,running,suspended,resuming,finishing"
+
+// UserJob is a job of the user not ended yet
+type UserJob struct {
+	ID    int    `json:"uid"`
+	State string `json:"state"`
+	Name  string `json:"name"`
+}
+
+// userJobsResponse is the API response to a jobs list request
+type userJobsResponse struct {
+	Items []UserJob `json:"items"`
+}
+
+// IsDockerG5kJob returns true if the job was submitted by docker-g5k (identified by its name)
+func (j *UserJob) IsDockerG5kJob() bool {
+	return j.Name == JobName
+}
+
+// GetUserJobs returns the jobs of the user not ended yet on the given site, with their name
+func (g *G5K) GetUserJobs(site string) ([]UserJob, error) {
+	// get the jobs of the user (the list only contains the job IDs and states)
+	var list userJobsResponse
+	if err := g.siteAPIRequest("GET", site, fmt.Sprintf("/jobs?user=%s&state=%s", g.username, aliveJobStates), nil, &list); err != nil {
+		return nil, err
+	}
+
+	// get the details of each job
+	jobs := []UserJob{}
+	for _, item := range list.Items {
+		var job UserJob
+		if err := g.siteAPIRequest("GET", site, fmt.Sprintf("/jobs/%d", item.ID), nil, &job); err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
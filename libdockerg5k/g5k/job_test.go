@@ -0,0 +1,63 @@
+package g5k
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatReservationDateUTC(t *testing.T) {
+	date := time.Date(2026, time.October, 20, 17, 0, 0, 0, time.UTC)
+	assert.Equal(t, "2026-10-20 19:00:00", FormatReservationDate(date))
+}
+
+func TestFormatReservationDateWinterTime(t *testing.T) {
+	date := time.Date(2026, time.December, 24, 23, 30, 0, 0, time.UTC)
+	assert.Equal(t, "2026-12-25 00:30:00", FormatReservationDate(date))
+}
+
+func TestParseReservationDate(t *testing.T) {
+	date, err := ParseReservationDate("2026-10-20 19:00:00")
+	assert.NoError(t, err)
+	assert.True(t, date.Equal(time.Date(2026, time.October, 20, 17, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "2026-10-20 19:00:00", FormatReservationDate(date))
+}
+
+func TestParseReservationDateIncorrectFormat(t *testing.T) {
+	_, err := ParseReservationDate("2026-10-20T19:00")
+	assert.Error(t, err)
+}
+
+func TestJobStatusRemaining(t *testing.T) {
+	start := time.Date(2026, time.October, 20, 17, 0, 0, 0, time.UTC)
+	status := JobStatus{State: "running", StartedAt: start, Walltime: 2 * time.Hour}
+	assert.Equal(t, 90*time.Minute, status.Remaining(start.Add(30*time.Minute)))
+	assert.Equal(t, time.Duration(0), status.Remaining(start.Add(3*time.Hour)))
+}
+
+func TestJobStatusRemainingNotRunning(t *testing.T) {
+	status := JobStatus{State: "terminated", StartedAt: time.Now(), Walltime: time.Hour}
+	assert.Equal(t, time.Duration(0), status.Remaining(time.Now()))
+	assert.True(t, status.IsEnded())
+}
+
+func TestUserJobIsDockerG5kJob(t *testing.T) {
+	job := UserJob{ID: 1, State: "running", Name: JobName}
+	assert.True(t, job.IsDockerG5kJob())
+
+	job = UserJob{ID: 2, State: "running", Name: "my-experiment"}
+	assert.False(t, job.IsDockerG5kJob())
+
+	job = UserJob{ID: 3, State: "running"}
+	assert.False(t, job.IsDockerG5kJob())
+}
+
+func TestJobStatusEndsAt(t *testing.T) {
+	start := time.Date(2026, time.October, 20, 17, 0, 0, 0, time.UTC)
+	status := JobStatus{State: "running", StartedAt: start, Walltime: 2 * time.Hour}
+	assert.Equal(t, start.Add(2*time.Hour), status.EndsAt())
+
+	status = JobStatus{State: "waiting"}
+	assert.True(t, status.EndsAt().IsZero())
+}
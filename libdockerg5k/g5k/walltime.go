@@ -0,0 +1,26 @@
+package g5k
+
+import (
+	"fmt"
+)
+
+// walltimeChangeRequest is a walltime change request for the OAR API
+type walltimeChangeRequest struct {
+	Walltime string `json:"walltime"`
+}
+
+// walltimeChangeResponse is the OAR API response to a walltime change request
+type walltimeChangeResponse struct {
+	Status string `json:"status"`
+}
+
+// ChangeJobWalltime request a walltime change for the given job on the given site and returns the OAR answer
+// The walltime can be absolute (hh:mm:ss) or relative to the current walltime (+hh:mm:ss, -hh:mm:ss)
+func (g *G5K) ChangeJobWalltime(site string, jobID int, walltime string) (string, error) {
+	var resp walltimeChangeResponse
+	if err := g.siteAPIRequest("POST", site, fmt.Sprintf("/internal/oarapi/jobs/%d/walltime.json", jobID), walltimeChangeRequest{Walltime: walltime}, &resp); err != nil {
+		return "", err
+	}
+
+	return resp.Status, nil
+}
@@ -3,6 +3,8 @@ package hostsmapping
 import (
 	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/docker/machine/libmachine/host"
 )
@@ -11,8 +13,8 @@ import (
 func generateHostsEntries(hostsLookupTable map[string]string) string {
 	var buffer bytes.Buffer
 
-	// append a header
-	buffer.WriteString("\n# docker-g5k:\n")
+	// append a header (no empty line before it, the removal of the block would leave it in place)
+	buffer.WriteString("# docker-g5k:\n")
 
 	// entry format: {ip}<tab>{hostname}
 	for hostname, ip := range hostsLookupTable {
@@ -22,7 +24,7 @@ func generateHostsEntries(hostsLookupTable map[string]string) string {
 	return buffer.String()
 }
 
-// AddClusterHostsMapping add cluster nodes name ({site}-{id}) to the static lookup table (/etc/hosts) of the node
+// AddClusterHostsMapping add cluster nodes name ({cluster}-{site}-{id}) to the static lookup table (/etc/hosts) of the node
 func AddClusterHostsMapping(h *host.Host, hostsLookupTable map[string]string) error {
 	// append entries at the end of the /etc/hosts file
 	if _, err := h.RunSSHCommand(fmt.Sprintf("echo '%s' >>/etc/hosts", generateHostsEntries(hostsLookupTable))); err != nil {
@@ -31,3 +33,92 @@ func AddClusterHostsMapping(h *host.Host, hostsLookupTable map[string]string) er
 
 	return nil
 }
+
+// RemoveClusterHostsMapping remove the cluster nodes entries from the static lookup table (/etc/hosts) of the node
+func RemoveClusterHostsMapping(h *host.Host) error {
+	// entries block starts with the header and ends with an empty line
+	if _, err := h.RunSSHCommand("sed -i '/^# docker-g5k:$/,/^$/d' /etc/hosts"); err != nil {
+		return fmt.Errorf("Failed to remove hosts from the static lookup table: '%s'", err)
+	}
+
+	return nil
+}
+
+// UpdateClusterHostsMapping replace the cluster nodes entries in the static lookup table (/etc/hosts) of the node
+func UpdateClusterHostsMapping(h *host.Host, hostsLookupTable map[string]string) error {
+	if err := RemoveClusterHostsMapping(h); err != nil {
+		return err
+	}
+
+	return AddClusterHostsMapping(h, hostsLookupTable)
+}
+
+// parseHostsEntries returns the number of cluster entries blocks in the static lookup table, and the entries of these blocks
+func parseHostsEntries(hosts string) (int, map[string]string) {
+	blocks := 0
+	entries := make(map[string]string)
+
+	inBlock := false
+	for _, line := range strings.Split(hosts, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "# docker-g5k:":
+			blocks++
+			inBlock = true
+		case line == "":
+			inBlock = false
+		case inBlock:
+			if fields := strings.Fields(line); len(fields) == 2 {
+				entries[fields[1]] = fields[0]
+			}
+		}
+	}
+
+	return blocks, entries
+}
+
+// diffHostsEntries returns the hostnames missing or with a different IP address in the entries, and the unexpected hostnames
+func diffHostsEntries(entries map[string]string, hostsLookupTable map[string]string) ([]string, []string) {
+	wrong := []string{}
+	for hostname, ip := range hostsLookupTable {
+		if entries[hostname] != ip {
+			wrong = append(wrong, hostname)
+		}
+	}
+	sort.Strings(wrong)
+
+	unexpected := []string{}
+	for hostname := range entries {
+		if _, ok := hostsLookupTable[hostname]; !ok {
+			unexpected = append(unexpected, hostname)
+		}
+	}
+	sort.Strings(unexpected)
+
+	return wrong, unexpected
+}
+
+// CheckClusterHostsMapping check the static lookup table (/etc/hosts) of the node contains a single block with the current cluster nodes entries
+func CheckClusterHostsMapping(h *host.Host, hostsLookupTable map[string]string) error {
+	hosts, err := h.RunSSHCommand("cat /etc/hosts")
+	if err != nil {
+		return fmt.Errorf("Failed to read the static lookup table: '%s'", err)
+	}
+
+	blocks, entries := parseHostsEntries(hosts)
+	if blocks != 1 {
+		return fmt.Errorf("%d cluster entries block(s) found instead of 1", blocks)
+	}
+
+	wrong, unexpected := diffHostsEntries(entries, hostsLookupTable)
+	if len(wrong) > 0 {
+		return fmt.Errorf("Missing or outdated entries: %s", strings.Join(wrong, ", "))
+	}
+
+	if len(unexpected) > 0 {
+		return fmt.Errorf("Unexpected entries: %s", strings.Join(unexpected, ", "))
+	}
+
+	return nil
+}
@@ -11,11 +11,33 @@ import (
 func TestGenerateHostsEntriesSingleIpv4(t *testing.T) {
 	hostsLookupTable := map[string]string{"lille-0": "1.2.3.4"}
 	entries := generateHostsEntries(hostsLookupTable)
-	assert.Equal(t, fmt.Sprintf("\n# docker-g5k:\n1.2.3.4\tlille-0\n"), entries)
+	assert.Equal(t, fmt.Sprintf("# docker-g5k:\n1.2.3.4\tlille-0\n"), entries)
 }
 
 func TestGenerateHostsEntriesSingleIpv6(t *testing.T) {
 	hostsLookupTable := map[string]string{"lille-0": "2001:db8:85a3::8a2e:370:7334"}
 	entries := generateHostsEntries(hostsLookupTable)
-	assert.Equal(t, fmt.Sprintf("\n# docker-g5k:\n2001:db8:85a3::8a2e:370:7334\tlille-0\n"), entries)
+	assert.Equal(t, fmt.Sprintf("# docker-g5k:\n2001:db8:85a3::8a2e:370:7334\tlille-0\n"), entries)
+}
+
+func TestParseHostsEntries(t *testing.T) {
+	hosts := "127.0.0.1\tlocalhost\n" + generateHostsEntries(map[string]string{"exp-lille-0": "1.2.3.4", "exp-lille-1": "1.2.3.5"}) + "\n"
+	blocks, entries := parseHostsEntries(hosts)
+	assert.Equal(t, 1, blocks)
+	assert.Equal(t, map[string]string{"exp-lille-0": "1.2.3.4", "exp-lille-1": "1.2.3.5"}, entries)
+}
+
+func TestParseHostsEntriesDuplicatedBlock(t *testing.T) {
+	block := generateHostsEntries(map[string]string{"exp-lille-0": "1.2.3.4"})
+	blocks, _ := parseHostsEntries(block + "\n" + block + "\n")
+	assert.Equal(t, 2, blocks)
+}
+
+func TestDiffHostsEntries(t *testing.T) {
+	entries := map[string]string{"exp-lille-0": "1.2.3.4", "exp-lille-1": "1.2.3.9", "exp-lille-3": "1.2.3.7"}
+	table := map[string]string{"exp-lille-0": "1.2.3.4", "exp-lille-1": "1.2.3.5", "exp-lille-2": "1.2.3.6"}
+
+	wrong, unexpected := diffHostsEntries(entries, table)
+	assert.Equal(t, []string{"exp-lille-1", "exp-lille-2"}, wrong)
+	assert.Equal(t, []string{"exp-lille-3"}, unexpected)
 }
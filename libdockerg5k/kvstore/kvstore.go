@@ -0,0 +1,133 @@
+package kvstore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/docker/machine/libmachine/host"
+
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/consul"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/etcd"
+	"github.com/Spirals-Team/docker-g5k/libdockerg5k/zookeeper"
+)
+
+// KVStore is a k/v store deployed on the Swarm master nodes for the Docker Engine/Swarm cluster storage
+type KVStore interface {
+	// GenerateURL returns the URL used for Swarm discovery and Docker Engine 'cluster-store' parameter
+	GenerateURL(masterNodes []string, hostsLookupTable map[string]string) string
+
+	// EngineFlags returns the Docker Engine flags needed to use the store at the given URL
+	EngineFlags(url string) []string
+
+	// Start run the store container on a Swarm master node
+	Start(h *host.Host, masterNodes []string, hostsLookupTable map[string]string) error
+
+	// WaitUntilReady wait until the store running on the given Swarm master nodes can serve requests
+	WaitUntilReady(hosts []*host.Host, timeout time.Duration) error
+
+	// ContainerName returns the name of the store container running on the Swarm master nodes
+	ContainerName() string
+}
+
+// stores contains the available k/v stores by name
+var stores = map[string]KVStore{
+	"zookeeper": zookeeperStore{},
+	"etcd":      etcdStore{},
+	"consul":    consulStore{},
+}
+
+// Get returns the k/v store with the given name
+func Get(name string) (KVStore, error) {
+	s, ok := stores[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown cluster store '%s' (available: %v)", name, Names())
+	}
+
+	return s, nil
+}
+
+// Names returns the sorted names of the available k/v stores
+func Names() []string {
+	names := []string{}
+	for n := range stores {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// engineFlags returns the Docker Engine flags to use a cluster store (advertise the Engine TLS port)
+func engineFlags(url string) []string {
+	return []string{"cluster-advertise=eth0:2376", fmt.Sprintf("cluster-store=%s", url)}
+}
+
+// zookeeperStore is the Zookeeper k/v store
+type zookeeperStore struct{}
+
+func (zookeeperStore) GenerateURL(masterNodes []string, hostsLookupTable map[string]string) string {
+	return zookeeper.GenerateClusterStorageURL(masterNodes, hostsLookupTable)
+}
+
+func (zookeeperStore) EngineFlags(url string) []string {
+	return engineFlags(url)
+}
+
+func (zookeeperStore) Start(h *host.Host, masterNodes []string, hostsLookupTable map[string]string) error {
+	return zookeeper.StartClusterStorage(h, masterNodes)
+}
+
+func (zookeeperStore) WaitUntilReady(hosts []*host.Host, timeout time.Duration) error {
+	return zookeeper.WaitForQuorum(hosts, timeout)
+}
+
+func (zookeeperStore) ContainerName() string {
+	return zookeeper.ContainerName
+}
+
+// etcdStore is the etcd k/v store
+type etcdStore struct{}
+
+func (etcdStore) GenerateURL(masterNodes []string, hostsLookupTable map[string]string) string {
+	return etcd.GenerateClusterStorageURL(masterNodes, hostsLookupTable)
+}
+
+func (etcdStore) EngineFlags(url string) []string {
+	return engineFlags(url)
+}
+
+func (etcdStore) Start(h *host.Host, masterNodes []string, hostsLookupTable map[string]string) error {
+	return etcd.StartClusterStorage(h, masterNodes, hostsLookupTable)
+}
+
+func (etcdStore) WaitUntilReady(hosts []*host.Host, timeout time.Duration) error {
+	return etcd.WaitForQuorum(hosts, timeout)
+}
+
+func (etcdStore) ContainerName() string {
+	return etcd.ContainerName
+}
+
+// consulStore is the Consul k/v store
+type consulStore struct{}
+
+func (consulStore) GenerateURL(masterNodes []string, hostsLookupTable map[string]string) string {
+	return consul.GenerateClusterStorageURL(masterNodes, hostsLookupTable)
+}
+
+func (consulStore) EngineFlags(url string) []string {
+	return engineFlags(url)
+}
+
+func (consulStore) Start(h *host.Host, masterNodes []string, hostsLookupTable map[string]string) error {
+	return consul.StartClusterStorage(h, masterNodes, hostsLookupTable)
+}
+
+func (consulStore) WaitUntilReady(hosts []*host.Host, timeout time.Duration) error {
+	return consul.WaitForQuorum(hosts, timeout)
+}
+
+func (consulStore) ContainerName() string {
+	return consul.ContainerName
+}
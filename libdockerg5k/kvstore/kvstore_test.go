@@ -0,0 +1,34 @@
+package kvstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetKnownStore(t *testing.T) {
+	s, err := Get("etcd")
+	assert.NoError(t, err)
+	assert.Equal(t, "etcd://10.0.0.0:2379", s.GenerateURL([]string{"lille-0"}, map[string]string{"lille-0": "10.0.0.0"}))
+}
+
+func TestGetUnknownStore(t *testing.T) {
+	_, err := Get("redis")
+	assert.Error(t, err)
+}
+
+func TestNames(t *testing.T) {
+	assert.Equal(t, []string{"consul", "etcd", "zookeeper"}, Names())
+}
+
+func TestEngineFlags(t *testing.T) {
+	s, _ := Get("zookeeper")
+	assert.Equal(t, []string{"cluster-advertise=eth0:2376", "cluster-store=zk://10.0.0.0"}, s.EngineFlags("zk://10.0.0.0"))
+}
+
+func TestContainerName(t *testing.T) {
+	for _, name := range Names() {
+		s, _ := Get(name)
+		assert.Equal(t, "docker-g5k-"+name, s.ContainerName())
+	}
+}
@@ -0,0 +1,53 @@
+package retry
+
+import (
+	"time"
+
+	"github.com/docker/machine/libmachine/log"
+)
+
+// Policy defines the number of attempts of an operation and the delay between the attempts (doubled after each failure)
+type Policy struct {
+	Attempts     int
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+}
+
+// Delay returns the delay to wait before the given retry (starting at 1)
+func (p Policy) Delay(retry int) time.Duration {
+	d := p.InitialDelay
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if p.MaxDelay > 0 && d >= p.MaxDelay {
+			return p.MaxDelay
+		}
+	}
+
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		return p.MaxDelay
+	}
+
+	return d
+}
+
+// Do run the operation until it succeeds or the number of attempts is reached, and returns the last error
+// The cleanup function (if not nil) is run before each retry to undo what the failed attempt left, its error stop the retries
+func (p Policy) Do(name string, op func() error, cleanup func() error) error {
+	err := op()
+	for attempt := 2; err != nil && attempt <= p.Attempts; attempt++ {
+		delay := p.Delay(attempt - 1)
+		log.Warnf("%s failed (attempt %d/%d): '%s', retrying in %s...", name, attempt-1, p.Attempts, err, delay)
+		time.Sleep(delay)
+
+		if cleanup != nil {
+			if cerr := cleanup(); cerr != nil {
+				log.Errorf("%s cleanup failed: '%s'", name, cerr)
+				return err
+			}
+		}
+
+		err = op()
+	}
+
+	return err
+}
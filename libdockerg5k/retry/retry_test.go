@@ -0,0 +1,79 @@
+package retry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDelayExponential(t *testing.T) {
+	p := Policy{Attempts: 5, InitialDelay: time.Second, MaxDelay: time.Minute}
+	assert.Equal(t, time.Second, p.Delay(1))
+	assert.Equal(t, 2*time.Second, p.Delay(2))
+	assert.Equal(t, 4*time.Second, p.Delay(3))
+}
+
+func TestDelayMaxDelay(t *testing.T) {
+	p := Policy{Attempts: 10, InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+	assert.Equal(t, 5*time.Second, p.Delay(4))
+	assert.Equal(t, 5*time.Second, p.Delay(10))
+}
+
+func TestDoSucceedAfterRetries(t *testing.T) {
+	p := Policy{Attempts: 3}
+	calls, cleanups := 0, 0
+	err := p.Do("test", func() error {
+		calls++
+		if calls < 3 {
+			return fmt.Errorf("failure")
+		}
+		return nil
+	}, func() error {
+		cleanups++
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, 2, cleanups)
+}
+
+func TestDoAttemptsReached(t *testing.T) {
+	p := Policy{Attempts: 2}
+	calls := 0
+	err := p.Do("test", func() error {
+		calls++
+		return fmt.Errorf("failure")
+	}, nil)
+
+	assert.Error(t, err)
+	assert.Equal(t, 2, calls)
+}
+
+func TestDoZeroAttempts(t *testing.T) {
+	p := Policy{}
+	calls := 0
+	err := p.Do("test", func() error {
+		calls++
+		return fmt.Errorf("failure")
+	}, nil)
+
+	assert.Error(t, err)
+	assert.Equal(t, 1, calls)
+}
+
+func TestDoCleanupFailure(t *testing.T) {
+	p := Policy{Attempts: 3}
+	calls := 0
+	err := p.Do("test", func() error {
+		calls++
+		return fmt.Errorf("failure")
+	}, func() error {
+		return fmt.Errorf("cleanup failure")
+	})
+
+	assert.EqualError(t, err, "failure")
+	assert.Equal(t, 1, calls)
+}
@@ -3,6 +3,7 @@ package swarm
 import (
 	"fmt"
 	"net"
+	"time"
 
 	"strings"
 
@@ -79,3 +80,104 @@ func (gc *SwarmModeGlobalConfig) JoinSwarmModeCluster(host *host.Host, isManager
 
 	return nil
 }
+
+// ForceLeaveSwarmMode makes the host leave the Swarm mode cluster it is part of (if any)
+func ForceLeaveSwarmMode(h *host.Host) error {
+	_, err := h.RunSSHCommand("docker swarm leave --force >/dev/null 2>&1 || true")
+	return err
+}
+
+// GetSwarmModeNodeID returns the Swarm mode node ID of the host
+func GetSwarmModeNodeID(h *host.Host) (string, error) {
+	out, err := h.RunSSHCommand("docker info --format '{{.Swarm.NodeID}}'")
+	if err != nil {
+		return "", err
+	}
+
+	nodeID := strings.TrimSpace(out)
+	if nodeID == "" {
+		return "", fmt.Errorf("The host is not part of a Swarm mode cluster")
+	}
+
+	return nodeID, nil
+}
+
+// DrainSwarmModeNode set the availability of the node to 'drain' and wait until its tasks are stopped (or the timeout is reached)
+func DrainSwarmModeNode(manager *host.Host, nodeID string, timeout time.Duration) error {
+	if _, err := manager.RunSSHCommand(fmt.Sprintf("docker node update --availability drain %s", nodeID)); err != nil {
+		return err
+	}
+
+	// wait until the tasks are rescheduled on the other nodes
+	for start := time.Now(); time.Since(start) < timeout; time.Sleep(5 * time.Second) {
+		out, err := manager.RunSSHCommand(fmt.Sprintf("docker node ps -q --filter desired-state=running %s", nodeID))
+		if err != nil {
+			return err
+		}
+
+		if strings.TrimSpace(out) == "" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("The tasks of the node are still running after %s", timeout)
+}
+
+// LeaveSwarmModeCluster demote the node (if manager), makes it leave the Swarm mode cluster and remove it from the nodes list
+func LeaveSwarmModeCluster(manager *host.Host, h *host.Host, nodeID string, isManager bool) error {
+	// a manager need to be demoted before leaving
+	if isManager {
+		if _, err := manager.RunSSHCommand(fmt.Sprintf("docker node demote %s", nodeID)); err != nil {
+			return err
+		}
+	}
+
+	// leave the cluster
+	if _, err := h.RunSSHCommand("docker swarm leave --force"); err != nil {
+		return err
+	}
+
+	// remove the node from the nodes list
+	if _, err := manager.RunSSHCommand(fmt.Sprintf("docker node rm --force %s", nodeID)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// GetSwarmModeNodeState returns the local Swarm mode state of the host ('active' if part of a cluster) and whether it is a manager
+func GetSwarmModeNodeState(h *host.Host) (string, bool, error) {
+	out, err := h.RunSSHCommand("docker info --format '{{.Swarm.LocalNodeState}} {{.Swarm.ControlAvailable}}'")
+	if err != nil {
+		return "", false, err
+	}
+
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", false, fmt.Errorf("Unexpected Swarm mode state: '%s'", strings.TrimSpace(out))
+	}
+
+	return fields[0], fields[1] == "true", nil
+}
+
+// parseNodeList returns the status of each node ID in the output of 'docker node ls --format "{{.ID}} {{.Status}}"'
+func parseNodeList(out string) map[string]string {
+	nodes := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 {
+			nodes[fields[0]] = fields[1]
+		}
+	}
+
+	return nodes
+}
+
+// ListSwarmModeNodes returns the status ('Ready', 'Down'...) of each node ID of the Swarm mode cluster, as seen by the given manager
+func ListSwarmModeNodes(manager *host.Host) (map[string]string, error) {
+	out, err := manager.RunSSHCommand("docker node ls --format '{{.ID}} {{.Status}}'")
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNodeList(out), nil
+}
@@ -0,0 +1,12 @@
+package swarm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNodeList(t *testing.T) {
+	out := "x1nk5ue4vbsw Ready\nqj2q8n7m0r1o Down\n\n"
+	assert.Equal(t, map[string]string{"x1nk5ue4vbsw": "Ready", "qj2q8n7m0r1o": "Down"}, parseNodeList(out))
+}
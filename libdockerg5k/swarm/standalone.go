@@ -1,6 +1,12 @@
 package swarm
 
 import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/docker/machine/libmachine/host"
 	"github.com/docker/machine/libmachine/swarm"
 )
 
@@ -29,3 +35,61 @@ func (gc *SwarmStandaloneGlobalConfig) CreateNodeConfig(nodeName string, isMaste
 		IsExperimental:     false,
 	}
 }
+
+// RemoveFromDiscovery stop the Swarm agent of the host, the node is no longer advertised in the discovery service
+func RemoveFromDiscovery(h *host.Host) error {
+	// Docker Machine names the Swarm agent container 'swarm-agent'
+	if _, err := h.RunSSHCommand("docker rm -f swarm-agent"); err != nil {
+		return fmt.Errorf("Unable to stop the Swarm agent: '%s'", err)
+	}
+
+	return nil
+}
+
+// swarmStandaloneInfoCommand query the Swarm standalone master of the host with the TLS certificates installed by Docker Machine
+const swarmStandaloneInfoCommand = "docker --tlsverify --tlscacert=/etc/docker/ca.pem --tlscert=/etc/docker/server.pem --tlskey=/etc/docker/server-key.pem -H tcp://localhost:3376 info --format '{{json .SystemStatus}}'"
+
+// parseSystemStatus returns the status ('Healthy', 'Pending'...) of each node in the system status of a Swarm standalone master, by node name and address
+func parseSystemStatus(out string) (map[string]string, error) {
+	var systemStatus [][2]string
+	if err := json.Unmarshal([]byte(out), &systemStatus); err != nil {
+		return nil, fmt.Errorf("Unexpected Swarm standalone system status: '%s'", strings.TrimSpace(out))
+	}
+
+	nodes := make(map[string]string)
+	current := []string{}
+	for _, pair := range systemStatus {
+		key := strings.TrimSpace(pair[0])
+		switch {
+		// node detail (ex: '  └ Status': 'Healthy')
+		case strings.HasPrefix(key, "└"):
+			if strings.TrimSpace(strings.TrimPrefix(key, "└")) == "Status" {
+				for _, k := range current {
+					nodes[k] = pair[1]
+				}
+			}
+
+		// node (ex: ' node-1': '172.16.0.1:2376')
+		case strings.HasPrefix(pair[0], " "):
+			current = []string{key}
+			if addr, _, err := net.SplitHostPort(pair[1]); err == nil {
+				current = append(current, addr)
+			}
+
+		default:
+			current = []string{}
+		}
+	}
+
+	return nodes, nil
+}
+
+// ListSwarmStandaloneNodes returns the status ('Healthy', 'Pending'...) of each node of the Swarm standalone cluster by node name and address, as seen by the given master
+func ListSwarmStandaloneNodes(master *host.Host) (map[string]string, error) {
+	out, err := master.RunSSHCommand(swarmStandaloneInfoCommand)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseSystemStatus(out)
+}
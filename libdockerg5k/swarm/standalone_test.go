@@ -0,0 +1,18 @@
+package swarm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSystemStatus(t *testing.T) {
+	out := `[["Role","primary"],["Strategy","spread"],["Nodes","2"],[" chetemi-1","172.16.37.1:2376"],["  └ ID","ABCD"],["  └ Status","Healthy"],[" chetemi-2","172.16.37.2:2376"],["  └ Status","Pending"],["Plugins",""]]`
+
+	nodes, err := parseSystemStatus(out)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"chetemi-1": "Healthy", "172.16.37.1": "Healthy", "chetemi-2": "Pending", "172.16.37.2": "Pending"}, nodes)
+
+	_, err = parseSystemStatus("Cannot connect to the Docker daemon")
+	assert.Error(t, err)
+}
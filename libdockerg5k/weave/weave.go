@@ -19,6 +19,13 @@ import (
 	"github.com/docker/machine/libmachine/host"
 )
 
+const (
+	// NetContainerName is the name of the Weave Net router container
+	NetContainerName = "weave"
+	// DiscoveryContainerName is the name of the Weave Discovery container
+	DiscoveryContainerName = "weavediscovery"
+)
+
 // RunWeaveNet run Weave Net on given host
 func RunWeaveNet(h *host.Host) error {
 	// Run Weave Net router with Docker plugin
@@ -32,9 +39,27 @@ func RunWeaveNet(h *host.Host) error {
 // RunWeaveDiscovery run Weave Discovery on a host using the given Swarm Discovery method
 func RunWeaveDiscovery(h *host.Host, swarmDiscovery string) error {
 	// Run Weave Discovery
-	if _, err := h.RunSSHCommand(fmt.Sprintf("docker run -d --name weavediscovery --net=host weaveworks/weavediscovery %s", swarmDiscovery)); err != nil {
+	if _, err := h.RunSSHCommand(fmt.Sprintf("docker run -d --name %s --net=host weaveworks/weavediscovery %s", DiscoveryContainerName, swarmDiscovery)); err != nil {
 		return fmt.Errorf("Weave Discovery run command failed: '%s'", err)
 	}
 
 	return nil
 }
+
+// ResetWeaveNet stop Weave Net on given host and remove its containers and configuration
+func ResetWeaveNet(h *host.Host) error {
+	if _, err := h.RunSSHCommand("docker run --rm -v /var/run/docker.sock:/var/run/docker.sock -v /proc:/hostproc -e PROCFS=/hostproc --privileged --net=host weaveworks/weaveexec --local reset"); err != nil {
+		return fmt.Errorf("Weave Net reset command failed: '%s'", err)
+	}
+
+	return nil
+}
+
+// RemoveWeaveDiscovery remove the Weave Discovery container of a host (if any)
+func RemoveWeaveDiscovery(h *host.Host) error {
+	if _, err := h.RunSSHCommand(fmt.Sprintf("docker rm -f %s >/dev/null 2>&1 || true", DiscoveryContainerName)); err != nil {
+		return fmt.Errorf("Weave Discovery remove command failed: '%s'", err)
+	}
+
+	return nil
+}
@@ -3,10 +3,14 @@ package zookeeper
 import (
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/docker/machine/libmachine/host"
 )
 
+// ContainerName is the name of the Zookeeper container running on the Swarm master nodes
+const ContainerName = "docker-g5k-zookeeper"
+
 // GenerateClusterStorageURL returns a string used for Docker Engine/Swarm cluster-store parameter (format=zk://node1,node2,nodeN...)
 func GenerateClusterStorageURL(zookeeperMasterNodes []string, hostsLookupTable map[string]string) string {
 	// get the master nodes IP address from the hosts lookup table
@@ -40,8 +44,13 @@ func StartClusterStorage(host *host.Host, zookeeperMasterNodes []string) error {
 			envID := fmt.Sprintf("ZOO_MY_ID=%d", i)
 			envServers := fmt.Sprintf("ZOO_SERVERS=%s", generateServerList(zookeeperMasterNodes))
 
+			// remove the container left by a previous provisionning
+			if _, err := host.RunSSHCommand("docker rm -f " + ContainerName + " >/dev/null 2>&1 || true"); err != nil {
+				return err
+			}
+
 			// start zookeeper container
-			if _, err := host.RunSSHCommand(fmt.Sprintf("docker run -td --restart=always --net=host --name docker-g5k-zookeeper -e \"%s\" -e \"%s\" zookeeper", envID, envServers)); err != nil {
+			if _, err := host.RunSSHCommand(fmt.Sprintf("docker run -td --restart=always --net=host --name %s -e \"%s\" -e \"%s\" zookeeper", ContainerName, envID, envServers)); err != nil {
 				return err
 			}
 
@@ -52,3 +61,74 @@ func StartClusterStorage(host *host.Host, zookeeperMasterNodes []string) error {
 	// host not found in Swarm master nodes list
 	return fmt.Errorf("This host is not in the given Zookeeper master nodes list")
 }
+
+// parseServerMode returns the mode of a zookeeper server (leader, follower, standalone) from the output of 'zkServer.sh status', or an empty string if the server is not serving
+func parseServerMode(status string) string {
+	for _, line := range strings.Split(status, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "Mode:") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "Mode:"))
+		}
+	}
+
+	return ""
+}
+
+// hasQuorum returns true if a leader is elected and a majority of the ensemble servers are serving requests
+func hasQuorum(modes []string) bool {
+	leader := false
+	serving := 0
+	for _, m := range modes {
+		switch m {
+		case "leader", "standalone":
+			leader = true
+			serving++
+		case "follower":
+			serving++
+		}
+	}
+
+	return leader && serving > len(modes)/2
+}
+
+// getServerMode returns the mode of the zookeeper server running on the host, or an empty string if the server is not serving
+func getServerMode(h *host.Host) string {
+	status, err := h.RunSSHCommand("docker exec " + ContainerName + " zkServer.sh status 2>&1")
+	if err != nil {
+		return ""
+	}
+
+	return parseServerMode(status)
+}
+
+// WaitForQuorum wait until the zookeeper ensemble running on the given hosts reach quorum, or returns an error after the timeout
+func WaitForQuorum(hosts []*host.Host, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		// get the mode of each server of the ensemble
+		modes := make([]string, len(hosts))
+		for i, h := range hosts {
+			modes[i] = getServerMode(h)
+		}
+
+		if hasQuorum(modes) {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			// report the state of each server
+			servers := []string{}
+			for i, h := range hosts {
+				mode := modes[i]
+				if mode == "" {
+					mode = "not serving"
+				}
+				servers = append(servers, fmt.Sprintf("%s: %s", h.Name, mode))
+			}
+
+			return fmt.Errorf("The Zookeeper ensemble did not reach quorum after %s (%s)", timeout, strings.Join(servers, ", "))
+		}
+
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -31,3 +31,29 @@ func TestGenerateServerListMultiMaster(t *testing.T) {
 	srvList := generateServerList(masters)
 	assert.Equal(t, "server.0=lille-0:2888:3888 server.1=sophia-1:2888:3888 server.2=lyon-2:2888:3888", srvList)
 }
+
+func TestParseServerModeFollower(t *testing.T) {
+	status := "ZooKeeper JMX enabled by default\nUsing config: /conf/zoo.cfg\nMode: follower\n"
+	assert.Equal(t, "follower", parseServerMode(status))
+}
+
+func TestParseServerModeNotRunning(t *testing.T) {
+	status := "ZooKeeper JMX enabled by default\nUsing config: /conf/zoo.cfg\nError contacting service. It is probably not running.\n"
+	assert.Equal(t, "", parseServerMode(status))
+}
+
+func TestHasQuorumStandalone(t *testing.T) {
+	assert.True(t, hasQuorum([]string{"standalone"}))
+}
+
+func TestHasQuorumMajority(t *testing.T) {
+	assert.True(t, hasQuorum([]string{"leader", "follower", ""}))
+}
+
+func TestHasQuorumNoLeader(t *testing.T) {
+	assert.False(t, hasQuorum([]string{"follower", "follower", ""}))
+}
+
+func TestHasQuorumMinority(t *testing.T) {
+	assert.False(t, hasQuorum([]string{"leader", "", "", ""}))
+}
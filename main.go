@@ -14,7 +14,7 @@ var (
 	// appFlags stores the application global flags
 	appFlags = []cli.Flag{}
 	// cliCommands stores the application commands
-	cliCommands = []cli.Command{command.CreateClusterCliCommand, command.ListClusterCliCommand, command.RemoveClusterCliCommand}
+	cliCommands = []cli.Command{command.CreateClusterCliCommand, command.DeployClusterCliCommand, command.ExtendClusterCliCommand, command.ListClusterCliCommand, command.ScaleClusterCliCommand, command.RemoveClusterCliCommand, command.WatchClusterCliCommand, command.CheckClusterCliCommand, command.GCCliCommand}
 )
 
 func main() {
@@ -26,5 +26,6 @@ func main() {
 
 	if err := app.Run(os.Args); err != nil {
 		log.Error(err)
+		os.Exit(1)
 	}
 }